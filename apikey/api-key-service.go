@@ -0,0 +1,126 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+const tokenPrefix = "mb_"
+
+type ApiKey struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Hosts      []string   `json:"hosts"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// IsHostAllowed returns true if the key may report for the given host.
+// A key without any hosts is not bound and may report for every host.
+func (k *ApiKey) IsHostAllowed(host string) bool {
+	if len(k.Hosts) == 0 {
+		return true
+	}
+	for _, allowedHost := range k.Hosts {
+		if allowedHost == host {
+			return true
+		}
+	}
+	return false
+}
+
+type ApiKeyService struct {
+	connPool *pgxpool.Pool
+}
+
+func NewApiKeyService(pool *pgxpool.Pool) (*ApiKeyService, error) {
+	return &ApiKeyService{connPool: pool}, nil
+}
+
+// CreateApiKey stores a new key and returns the plain text token. Only the hash of the token
+// is stored, so the token can not be shown again later.
+func (s *ApiKeyService) CreateApiKey(name string, hosts []string) (string, *ApiKey, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", nil, err
+	}
+	if hosts == nil {
+		hosts = []string{}
+	}
+	apiKey := &ApiKey{Name: name, Hosts: hosts}
+	err = s.connPool.QueryRow(context.Background(), `
+insert into "api_key" ("name", "hash", "hosts")
+values ($1, $2, $3)
+returning id, created_at
+`, name, HashToken(token), hosts).Scan(&apiKey.Id, &apiKey.CreatedAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, apiKey, nil
+}
+
+func (s *ApiKeyService) GetAllApiKeys() ([]ApiKey, error) {
+	rows, err := s.connPool.Query(context.Background(), `select id, name, hosts, created_at, last_used_at from api_key
+order by name, id
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apiKeys := make([]ApiKey, 0)
+	for rows.Next() {
+		var apiKey ApiKey
+		err := rows.Scan(&apiKey.Id, &apiKey.Name, &apiKey.Hosts, &apiKey.CreatedAt, &apiKey.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, nil
+}
+
+func (s *ApiKeyService) DeleteApiKey(id int) error {
+	_, err := s.connPool.Exec(context.Background(), `delete from "api_key" where id = $1`, id)
+	return err
+}
+
+// ValidateApiKey looks up the key belonging to the token and records that it was used.
+// If no key exists for the token nil is returned.
+func (s *ApiKeyService) ValidateApiKey(token string) (*ApiKey, error) {
+	var apiKey ApiKey
+	err := s.connPool.QueryRow(context.Background(), `
+update "api_key" set last_used_at = now()
+where hash = $1
+returning id, name, hosts, created_at, last_used_at
+`, HashToken(token)).Scan(&apiKey.Id, &apiKey.Name, &apiKey.Hosts, &apiKey.CreatedAt, &apiKey.LastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func HashToken(token string) string {
+	h := sha256.New()
+	h.Write([]byte(token))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func generateToken() (string, error) {
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return tokenPrefix + hex.EncodeToString(randomBytes), nil
+}
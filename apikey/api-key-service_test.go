@@ -0,0 +1,57 @@
+package apikey
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestApiKeyIsHostAllowed(t *testing.T) {
+	t.Run("should allow every host for a key without hosts", func(t *testing.T) {
+		apiKey := &ApiKey{Name: "all"}
+		assert.True(t, apiKey.IsHostAllowed("server-1"))
+		assert.True(t, apiKey.IsHostAllowed(""))
+	})
+
+	t.Run("should only allow the hosts of a bound key", func(t *testing.T) {
+		apiKey := &ApiKey{Name: "bound", Hosts: []string{"server-1", "server-2"}}
+		assert.True(t, apiKey.IsHostAllowed("server-1"))
+		assert.True(t, apiKey.IsHostAllowed("server-2"))
+		assert.False(t, apiKey.IsHostAllowed("server-3"))
+		assert.False(t, apiKey.IsHostAllowed("Server-1"))
+		assert.False(t, apiKey.IsHostAllowed(""))
+	})
+}
+
+func TestToken(t *testing.T) {
+	t.Run("should generate random tokens with the mb_ prefix", func(t *testing.T) {
+		// act
+		first, err := generateToken()
+		assert.NoError(t, err)
+		second, err := generateToken()
+		assert.NoError(t, err)
+
+		// assert
+		assert.Regexp(t, regexp.MustCompile(`^mb_[0-9a-f]{64}$`), first)
+		assert.NotEqual(t, first, second)
+	})
+
+	t.Run("should hash a token the same way every time", func(t *testing.T) {
+		// arrange
+		token, err := generateToken()
+		assert.NoError(t, err)
+
+		// act
+		hash := HashToken(token)
+
+		// assert
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{64}$`), hash)
+		assert.Equal(t, hash, HashToken(token))
+		assert.NotContains(t, hash, token[len(tokenPrefix):])
+	})
+
+	t.Run("should hash different tokens differently", func(t *testing.T) {
+		assert.NotEqual(t, HashToken("mb_a"), HashToken("mb_b"))
+		assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", HashToken("hello"))
+	})
+}
@@ -0,0 +1,80 @@
+package apikey
+
+import (
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type ApiKeyRow struct {
+	Id     string
+	Name   string
+	Values []string
+}
+
+type ApiKeyTable struct {
+	Headers      []string
+	Rows         []ApiKeyRow
+	DeleteLabel  string
+	CreatedToken string
+	CreatedName  string
+}
+
+type ApiKeyView struct {
+	apiKeyService *ApiKeyService
+}
+
+func NewApiKeyView(apiKeyService *ApiKeyService) *ApiKeyView {
+	return &ApiKeyView{apiKeyService: apiKeyService}
+}
+
+// Render shows all api keys. If a key was just created its token is passed along,
+// because this is the only time it can be displayed.
+func (v *ApiKeyView) Render(c echo.Context, createdName string, createdToken string) error {
+	apiKeys, err := v.apiKeyService.GetAllApiKeys()
+	if err != nil {
+		log.Println("failed to get api keys", err)
+		return err
+	}
+	table := &ApiKeyTable{
+		Headers:      []string{"Name", "Hosts", "Created", "Last used"},
+		Rows:         []ApiKeyRow{},
+		DeleteLabel:  "Delete",
+		CreatedToken: createdToken,
+		CreatedName:  createdName,
+	}
+	for _, apiKey := range apiKeys {
+		table.Rows = append(table.Rows, apiKeyToRow(apiKey))
+	}
+	return c.Render(http.StatusOK, "apiKeys", table)
+}
+
+func apiKeyToRow(apiKey ApiKey) ApiKeyRow {
+	hosts := "all"
+	if len(apiKey.Hosts) > 0 {
+		hosts = strings.Join(apiKey.Hosts, ", ")
+	}
+	lastUsed := "never"
+	if apiKey.LastUsedAt != nil {
+		lastUsed = apiKey.LastUsedAt.Format("2006-01-02 15:04:05")
+	}
+	return ApiKeyRow{
+		Id:   strconv.Itoa(apiKey.Id),
+		Name: apiKey.Name,
+		Values: []string{
+			apiKey.Name,
+			hosts,
+			apiKey.CreatedAt.Format("2006-01-02 15:04:05"),
+			lastUsed,
+		},
+	}
+}
+
+// ParseHosts splits a comma or whitespace separated list of host names.
+func ParseHosts(hosts string) []string {
+	return strings.FieldsFunc(hosts, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t' || r == '\r'
+	})
+}
@@ -0,0 +1,17 @@
+package apikey
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseHosts(t *testing.T) {
+	t.Run("should split by commas and whitespace", func(t *testing.T) {
+		assert.Equal(t, []string{"server-1", "server-2", "server-3", "server-4"}, ParseHosts(" server-1, server-2\nserver-3\r\n\tserver-4 "))
+	})
+
+	t.Run("should return no hosts for an empty value", func(t *testing.T) {
+		assert.Empty(t, ParseHosts(""))
+		assert.Empty(t, ParseHosts(" , \n"))
+	})
+}
@@ -0,0 +1,208 @@
+package ingest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxLineProtocolLineLength = 1 << 20
+
+type InfluxPoint struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any
+	Timestamp   time.Time
+}
+
+// ToSeries creates one series per numeric or boolean field, named like Telegraf's Prometheus
+// output <measurement>_<field>. String fields are skipped.
+func (p InfluxPoint) ToSeries() []Series {
+	seriesList := make([]Series, 0, len(p.Fields))
+	for _, field := range sortedFieldKeys(p.Fields) {
+		var value float64
+		switch fieldValue := p.Fields[field].(type) {
+		case float64:
+			value = fieldValue
+		case int64:
+			value = float64(fieldValue)
+		case uint64:
+			value = float64(fieldValue)
+		case bool:
+			if fieldValue {
+				value = 1
+			}
+		default:
+			continue
+		}
+		seriesList = append(seriesList, Series{
+			Name:      p.Measurement + "_" + field,
+			Labels:    p.Tags,
+			Value:     value,
+			Timestamp: p.Timestamp,
+		})
+	}
+	return seriesList
+}
+
+func sortedFieldKeys(fields map[string]any) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ParsePrecision accepts the precisions of the InfluxDB v2 (ns, us, ms, s) and v1 (n, u, ms, s, m, h) APIs.
+func ParsePrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "ns", "n":
+		return time.Nanosecond, nil
+	case "us", "u":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "h":
+		return time.Hour, nil
+	}
+	return 0, fmt.Errorf("invalid precision %q", precision)
+}
+
+// ParseLineProtocol parses all points of the body. Points without timestamp get the time now.
+// All problems are returned, so that the client can fix all of them at once.
+func ParseLineProtocol(body io.Reader, precision time.Duration, now time.Time) ([]InfluxPoint, []string, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxLineProtocolLineLength)
+	points := make([]InfluxPoint, 0)
+	problems := make([]string, 0)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		point, err := parseLine(line, precision, now)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %v: %v", lineNumber, err))
+			continue
+		}
+		points = append(points, point)
+	}
+	return points, problems, scanner.Err()
+}
+
+func parseLine(line string, precision time.Duration, now time.Time) (InfluxPoint, error) {
+	point := InfluxPoint{Tags: map[string]string{}, Fields: map[string]any{}, Timestamp: now}
+
+	seriesKey, rest := splitUnescaped(line, ' ', false)
+	measurement, tags := splitUnescaped(seriesKey, ',', false)
+	point.Measurement = unescape(measurement)
+	if point.Measurement == "" {
+		return point, fmt.Errorf("missing measurement")
+	}
+	for tags != "" {
+		var tag string
+		tag, tags = splitUnescaped(tags, ',', false)
+		key, value := splitUnescaped(tag, '=', false)
+		if key == "" || value == "" {
+			return point, fmt.Errorf("invalid tag %q", tag)
+		}
+		point.Tags[unescape(key)] = unescape(value)
+	}
+
+	fields, timestamp := splitUnescaped(rest, ' ', true)
+	if fields == "" {
+		return point, fmt.Errorf("missing fields")
+	}
+	for fields != "" {
+		var field string
+		field, fields = splitUnescaped(fields, ',', true)
+		key, value := splitUnescaped(field, '=', false)
+		if key == "" {
+			return point, fmt.Errorf("invalid field %q", field)
+		}
+		parsedValue, err := parseFieldValue(value)
+		if err != nil {
+			return point, fmt.Errorf("field %v: %w", unescape(key), err)
+		}
+		point.Fields[unescape(key)] = parsedValue
+	}
+
+	timestamp = strings.TrimSpace(timestamp)
+	if timestamp != "" {
+		timestampInt, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return point, fmt.Errorf("invalid timestamp %q", timestamp)
+		}
+		// the timestamp has to fit into nanoseconds, e.g. nanoseconds sent with precision s don't
+		if timestampInt > math.MaxInt64/int64(precision) || timestampInt < math.MinInt64/int64(precision) {
+			return point, fmt.Errorf("timestamp %q is out of range for the precision %v", timestamp, precision)
+		}
+		point.Timestamp = time.Unix(0, timestampInt*int64(precision))
+	}
+	return point, nil
+}
+
+func parseFieldValue(value string) (any, error) {
+	switch {
+	case value == "":
+		return nil, fmt.Errorf("missing value")
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return nil, fmt.Errorf("unterminated string %v", value)
+		}
+		return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1]), nil
+	case strings.HasSuffix(value, "i"):
+		return strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+	case strings.HasSuffix(value, "u"):
+		return strconv.ParseUint(strings.TrimSuffix(value, "u"), 10, 64)
+	}
+	switch value {
+	case "t", "T", "true", "True", "TRUE":
+		return true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return false, nil
+	}
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(floatValue) || math.IsInf(floatValue, 0) {
+		return nil, fmt.Errorf("invalid number %v", value)
+	}
+	return floatValue, nil
+}
+
+// splitUnescaped splits at the first separator that is neither escaped with a backslash nor,
+// if quotes is set, inside a quoted string.
+func splitUnescaped(value string, separator byte, quotes bool) (string, string) {
+	inQuotes := false
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\':
+			i++
+		case quotes && value[i] == '"':
+			inQuotes = !inQuotes
+		case value[i] == separator && !inQuotes:
+			return value[:i], value[i+1:]
+		}
+	}
+	return value, ""
+}
+
+var unescapeReplacer = strings.NewReplacer(`\,`, `,`, `\=`, `=`, `\ `, ` `, `\\`, `\`)
+
+func unescape(value string) string {
+	return unescapeReplacer.Replace(value)
+}
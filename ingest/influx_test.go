@@ -0,0 +1,95 @@
+package ingest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLineProtocol(t *testing.T) {
+	now := time.UnixMilli(1723552255000)
+
+	t.Run("should parse tags, all field types and the timestamp", func(t *testing.T) {
+		body := `# comment
+disk,host=server-1,path=/mnt/my\ disk used_percent=91.5,inodes_free=100i,total=200u,readonly=f,label="a \"b\", c" 1723552256
+
+cpu,host=server-1 usage_idle=12`
+
+		points, problems, err := ParseLineProtocol(strings.NewReader(body), time.Second, now)
+
+		assert.NoError(t, err)
+		assert.Empty(t, problems)
+		assert.Equal(t, []InfluxPoint{
+			{
+				Measurement: "disk",
+				Tags:        map[string]string{"host": "server-1", "path": "/mnt/my disk"},
+				Fields: map[string]any{
+					"used_percent": 91.5,
+					"inodes_free":  int64(100),
+					"total":        uint64(200),
+					"readonly":     false,
+					"label":        `a "b", c`,
+				},
+				Timestamp: time.Unix(1723552256, 0),
+			},
+			{
+				Measurement: "cpu",
+				Tags:        map[string]string{"host": "server-1"},
+				Fields:      map[string]any{"usage_idle": 12.0},
+				Timestamp:   now,
+			},
+		}, points)
+	})
+
+	t.Run("should report every invalid line", func(t *testing.T) {
+		body := "cpu\ncpu,host usage=1\ncpu usage=abc\ncpu usage=1 notatime\ncpu usage=1"
+
+		points, problems, err := ParseLineProtocol(strings.NewReader(body), time.Nanosecond, now)
+
+		assert.NoError(t, err)
+		assert.Len(t, points, 1)
+		assert.Equal(t, []string{
+			"line 1: missing fields",
+			`line 2: invalid tag "host"`,
+			`line 3: field usage: strconv.ParseFloat: parsing "abc": invalid syntax`,
+			`line 4: invalid timestamp "notatime"`,
+		}, problems)
+	})
+
+	t.Run("should reject a timestamp that overflows the precision", func(t *testing.T) {
+		body := "cpu usage=1 1723552256000000000\ncpu usage=1 -1723552256000000000\ncpu usage=1 1723552256"
+
+		points, problems, err := ParseLineProtocol(strings.NewReader(body), time.Second, now)
+
+		assert.NoError(t, err)
+		assert.Len(t, points, 1)
+		assert.Equal(t, time.Unix(1723552256, 0), points[0].Timestamp)
+		assert.Equal(t, []string{
+			`line 1: timestamp "1723552256000000000" is out of range for the precision 1s`,
+			`line 2: timestamp "-1723552256000000000" is out of range for the precision 1s`,
+		}, problems)
+	})
+}
+
+func TestInfluxPointToSeries(t *testing.T) {
+	point := InfluxPoint{
+		Measurement: "disk",
+		Tags:        map[string]string{"host": "server-1"},
+		Fields:      map[string]any{"used_percent": 91.5, "readonly": true, "label": "root"},
+		Timestamp:   time.Unix(1723552256, 0),
+	}
+
+	assert.Equal(t, []Series{
+		{Name: "disk_readonly", Labels: point.Tags, Value: 1, Timestamp: point.Timestamp},
+		{Name: "disk_used_percent", Labels: point.Tags, Value: 91.5, Timestamp: point.Timestamp},
+	}, point.ToSeries())
+}
+
+func TestParsePrecision(t *testing.T) {
+	precision, err := ParsePrecision("u")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Microsecond, precision)
+	_, err = ParsePrecision("weeks")
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/gorlug/metrics-backend/metrics"
+	"log"
+)
+
+type IngestResult struct {
+	Saved      int `json:"saved"`
+	Dropped    int `json:"dropped"`
+	Invalid    int `json:"invalid"`
+	Forbidden  int `json:"forbidden"`
+	OutOfOrder int `json:"outOfOrder"`
+	Future     int `json:"future"`
+}
+
+// MetricWriter validates and saves the metrics of one ingestion request and counts the outcome.
+type MetricWriter struct {
+	metricsService MetricsService
+	isHostAllowed  func(host string) bool
+	Result         IngestResult
+}
+
+func NewMetricWriter(metricsService MetricsService, isHostAllowed func(host string) bool) *MetricWriter {
+	return &MetricWriter{metricsService: metricsService, isHostAllowed: isHostAllowed}
+}
+
+// Write skips invalid metrics, metrics of hosts that are not allowed and out of order or future
+// samples. An error is only returned if saving failed.
+func (w *MetricWriter) Write(metric MetricValues) error {
+	if problems := metric.Validate(); len(problems) > 0 {
+		log.Printf("skipping invalid metric %v: %v", metric.String(), problems)
+		w.Result.Invalid++
+		return nil
+	}
+	if !w.isHostAllowed(metric.Host) {
+		w.Result.Forbidden++
+		return nil
+	}
+	err := w.metricsService.SaveMetric(metric)
+	if errors.Is(err, ErrOutOfOrderSample) {
+		w.Result.OutOfOrder++
+		return nil
+	}
+	if errors.Is(err, ErrFutureSample) {
+		w.Result.Future++
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save metric %v: %w", metric.String(), err)
+	}
+	w.Result.Saved++
+	return nil
+}
+
+// Complete is true if all metrics were saved or dropped on purpose by a rule.
+func (r IngestResult) Complete() bool {
+	return r.Invalid == 0 && r.Forbidden == 0 && r.OutOfOrder == 0 && r.Future == 0
+}
+
+// WriteSeries maps the series to metrics and writes them.
+func (w *MetricWriter) WriteSeries(series []Series, mapper *SeriesMapper) error {
+	for _, s := range series {
+		metric, ok := mapper.Map(s)
+		if !ok {
+			w.Result.Dropped++
+			continue
+		}
+		err := w.Write(metric)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package ingest
+
+import (
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type saveErrorMetricsService struct {
+	errors map[string]error
+}
+
+func (s *saveErrorMetricsService) SaveMetric(metric MetricValues) error {
+	return s.errors[metric.Name]
+}
+
+func (s *saveErrorMetricsService) SaveState(MetricValues, MetricState) error {
+	return nil
+}
+
+func (s *saveErrorMetricsService) GetAllMetrics() ([]Metric, error) {
+	return nil, nil
+}
+
+func TestMetricWriter(t *testing.T) {
+	// arrange
+	service := &saveErrorMetricsService{errors: map[string]error{"old": ErrOutOfOrderSample, "future": ErrFutureSample}}
+	writer := NewMetricWriter(service, func(host string) bool {
+		return host != "forbidden"
+	})
+	metric := func(host string, name string) MetricValues {
+		return MetricValues{Host: host, Name: name, Type: Gauge, Value: "1", Timestamp: time.Now()}
+	}
+
+	// act
+	for _, m := range []MetricValues{metric("server-1", "new"), metric("server-1", "old"), metric("server-1", "future"), metric("forbidden", "new"), metric("", "new")} {
+		assert.NoError(t, writer.Write(m))
+	}
+
+	// assert
+	assert.Equal(t, IngestResult{Saved: 1, Invalid: 1, Forbidden: 1, OutOfOrder: 1, Future: 1}, writer.Result)
+	assert.False(t, writer.Result.Complete())
+}
@@ -0,0 +1,331 @@
+package ingest
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gorlug/metrics-backend/journal"
+	. "github.com/gorlug/metrics-backend/metrics"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OtlpProtobufContentType = "application/x-protobuf"
+	OtlpJsonContentType     = "application/json"
+)
+
+const otlpHostAttribute = "host.name"
+const otlpServiceAttribute = "service.name"
+
+// ParseOtlpContentType returns the supported content type of an OTLP request or an error.
+func ParseOtlpContentType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("invalid content type %q", contentType)
+	}
+	switch mediaType {
+	case OtlpProtobufContentType, OtlpJsonContentType:
+		return mediaType, nil
+	}
+	return "", fmt.Errorf("unsupported content type %q", contentType)
+}
+
+func unmarshalOtlp(body []byte, contentType string, message proto.Message) error {
+	if contentType == OtlpProtobufContentType {
+		return proto.Unmarshal(body, message)
+	}
+	body, err := hexIdsToBase64(body)
+	if err != nil {
+		return err
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, message)
+}
+
+// MarshalOtlp encodes a response in the content type of the request.
+func MarshalOtlp(message proto.Message, contentType string) ([]byte, error) {
+	if contentType == OtlpProtobufContentType {
+		return proto.Marshal(message)
+	}
+	return protojson.Marshal(message)
+}
+
+// hexIdsToBase64 converts the trace and span ids of OTLP/JSON. Other than in the standard
+// protobuf JSON mapping they are encoded as hex instead of base64.
+func hexIdsToBase64(body []byte) ([]byte, error) {
+	var document any
+	err := json.Unmarshal(body, &document)
+	if err != nil {
+		return nil, err
+	}
+	var convert func(value any)
+	convert = func(value any) {
+		switch typedValue := value.(type) {
+		case map[string]any:
+			for key, child := range typedValue {
+				if id, ok := child.(string); ok && (key == "traceId" || key == "spanId") {
+					decoded, err := hex.DecodeString(id)
+					if err == nil {
+						typedValue[key] = base64.StdEncoding.EncodeToString(decoded)
+					}
+					continue
+				}
+				convert(child)
+			}
+		case []any:
+			for _, child := range typedValue {
+				convert(child)
+			}
+		}
+	}
+	convert(document)
+	return json.Marshal(document)
+}
+
+func DecodeOtlpMetrics(body []byte, contentType string) (*colmetricspb.ExportMetricsServiceRequest, error) {
+	request := &colmetricspb.ExportMetricsServiceRequest{}
+	err := unmarshalOtlp(body, contentType, request)
+	return request, err
+}
+
+func DecodeOtlpLogs(body []byte, contentType string) (*collogspb.ExportLogsServiceRequest, error) {
+	request := &collogspb.ExportLogsServiceRequest{}
+	err := unmarshalOtlp(body, contentType, request)
+	return request, err
+}
+
+// OtlpMetricsToMetricValues converts the data points of gauges and sums. The host.name resource
+// attribute becomes the host, the other resource attributes and the data point attributes become
+// labels. The data point attributes are also appended to the name. Only the newest data point of
+// every metric is returned. The second return value is the number of skipped data points.
+func OtlpMetricsToMetricValues(request *colmetricspb.ExportMetricsServiceRequest, now time.Time) ([]MetricValues, int) {
+	metrics := make([]MetricValues, 0)
+	indexByKey := map[string]int{}
+	skipped := 0
+	for _, resourceMetrics := range request.GetResourceMetrics() {
+		resourceLabels := attributesToLabels(resourceMetrics.GetResource().GetAttributes())
+		host := resourceLabels[otlpHostAttribute]
+		delete(resourceLabels, otlpHostAttribute)
+		for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+			for _, metric := range scopeMetrics.GetMetrics() {
+				var dataPoints []*metricspb.NumberDataPoint
+				switch {
+				case metric.GetGauge() != nil:
+					dataPoints = metric.GetGauge().GetDataPoints()
+				case metric.GetSum() != nil:
+					dataPoints = metric.GetSum().GetDataPoints()
+				default:
+					skipped += countOtherDataPoints(metric)
+					continue
+				}
+				for _, dataPoint := range dataPoints {
+					if host == "" {
+						skipped++
+						continue
+					}
+					metricValues := dataPointToMetricValues(host, metric.GetName(), resourceLabels, dataPoint, now)
+					key := metricValues.Host + "\xff" + metricValues.Name
+					index, exists := indexByKey[key]
+					if !exists {
+						indexByKey[key] = len(metrics)
+						metrics = append(metrics, metricValues)
+						continue
+					}
+					skipped++
+					if metricValues.Timestamp.After(metrics[index].Timestamp) {
+						metrics[index] = metricValues
+					}
+				}
+			}
+		}
+	}
+	return metrics, skipped
+}
+
+func countOtherDataPoints(metric *metricspb.Metric) int {
+	switch {
+	case metric.GetHistogram() != nil:
+		return len(metric.GetHistogram().GetDataPoints())
+	case metric.GetExponentialHistogram() != nil:
+		return len(metric.GetExponentialHistogram().GetDataPoints())
+	case metric.GetSummary() != nil:
+		return len(metric.GetSummary().GetDataPoints())
+	}
+	return 0
+}
+
+func dataPointToMetricValues(host string, name string, resourceLabels map[string]string, dataPoint *metricspb.NumberDataPoint, now time.Time) MetricValues {
+	pointLabels := attributesToLabels(dataPoint.GetAttributes())
+	labels := map[string]string{}
+	for key, value := range resourceLabels {
+		labels[key] = value
+	}
+	for key, value := range pointLabels {
+		labels[key] = value
+	}
+
+	var value float64
+	switch dataPoint.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		value = float64(dataPoint.GetAsInt())
+	default:
+		value = dataPoint.GetAsDouble()
+	}
+
+	return MetricValues{
+		Host:      host,
+		Name:      FormatSeriesName(name, pointLabels, sortedLabelKeys(pointLabels)),
+		Type:      Gauge,
+		Timestamp: unixNanoOrNow(dataPoint.GetTimeUnixNano(), now),
+		Value:     strconv.FormatFloat(value, 'f', -1, 64),
+		Labels:    labels,
+	}
+}
+
+// OtlpLogsToLogsEntries converts log records into journal entries. The fields that the journal
+// view uses are filled like journald would, the attributes are stored as well.
+func OtlpLogsToLogsEntries(request *collogspb.ExportLogsServiceRequest, now time.Time) ([]*journal.LogsEntry, error) {
+	entries := make([]*journal.LogsEntry, 0)
+	for _, resourceLogs := range request.GetResourceLogs() {
+		resourceAttributes := attributesToMap(resourceLogs.GetResource().GetAttributes())
+		for _, scopeLogs := range resourceLogs.GetScopeLogs() {
+			for _, record := range scopeLogs.GetLogRecords() {
+				timestamp := unixNanoOrNow(record.GetTimeUnixNano(), unixNanoOrNow(record.GetObservedTimeUnixNano(), now))
+				logMap := map[string]any{
+					"MESSAGE":              anyValueToString(record.GetBody()),
+					"__REALTIME_TIMESTAMP": strconv.FormatInt(timestamp.UnixMicro(), 10),
+					"_TRANSPORT":           "otlp",
+					"attributes":           attributesToMap(record.GetAttributes()),
+					"resource":             resourceAttributes,
+				}
+				if host, ok := stringAttribute(resourceAttributes, otlpHostAttribute); ok {
+					logMap["_HOSTNAME"] = host
+				}
+				if service, ok := stringAttribute(resourceAttributes, otlpServiceAttribute); ok {
+					logMap["SYSLOG_IDENTIFIER"] = service
+				}
+				setIfNotEmpty(logMap, "PRIORITY", severityToPriority(record.GetSeverityNumber()))
+				setIfNotEmpty(logMap, "SEVERITY_TEXT", record.GetSeverityText())
+				setIfNotEmpty(logMap, "TRACE_ID", hex.EncodeToString(record.GetTraceId()))
+				setIfNotEmpty(logMap, "SPAN_ID", hex.EncodeToString(record.GetSpanId()))
+				setIfNotEmpty(logMap, "SCOPE_NAME", scopeLogs.GetScope().GetName())
+
+				entry, err := journal.NewLogsEntry(timestamp, logMap)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func setIfNotEmpty(logMap map[string]any, key string, value string) {
+	if value != "" {
+		logMap[key] = value
+	}
+}
+
+// stringAttribute returns false if the attribute is missing, empty or not a string.
+func stringAttribute(attributes map[string]any, key string) (string, bool) {
+	value, ok := attributes[key].(string)
+	return value, ok && value != ""
+}
+
+// severityToPriority maps the OpenTelemetry severity to the syslog priority used by journald.
+func severityToPriority(severity logspb.SeverityNumber) string {
+	switch {
+	case severity == logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED:
+		return ""
+	case severity <= logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG4:
+		return "7"
+	case severity <= logspb.SeverityNumber_SEVERITY_NUMBER_INFO4:
+		return "6"
+	case severity <= logspb.SeverityNumber_SEVERITY_NUMBER_WARN4:
+		return "4"
+	case severity <= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR4:
+		return "3"
+	}
+	return "2"
+}
+
+func unixNanoOrNow(unixNano uint64, now time.Time) time.Time {
+	if unixNano == 0 {
+		return now
+	}
+	return time.Unix(0, int64(unixNano))
+}
+
+func attributesToLabels(attributes []*commonpb.KeyValue) map[string]string {
+	labels := map[string]string{}
+	for _, attribute := range attributes {
+		labels[attribute.GetKey()] = anyValueToString(attribute.GetValue())
+	}
+	return labels
+}
+
+func attributesToMap(attributes []*commonpb.KeyValue) map[string]any {
+	attributeMap := map[string]any{}
+	for _, attribute := range attributes {
+		attributeMap[attribute.GetKey()] = anyValueToInterface(attribute.GetValue())
+	}
+	return attributeMap
+}
+
+func anyValueToString(value *commonpb.AnyValue) string {
+	switch typedValue := anyValueToInterface(value).(type) {
+	case nil:
+		return ""
+	case string:
+		return typedValue
+	case []any, map[string]any:
+		encoded, err := json.Marshal(typedValue)
+		if err != nil {
+			return fmt.Sprint(typedValue)
+		}
+		return string(encoded)
+	default:
+		return fmt.Sprint(typedValue)
+	}
+}
+
+func anyValueToInterface(value *commonpb.AnyValue) any {
+	switch typedValue := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return typedValue.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return typedValue.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return typedValue.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return typedValue.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(typedValue.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, 0, len(typedValue.ArrayValue.GetValues()))
+		for _, arrayValue := range typedValue.ArrayValue.GetValues() {
+			values = append(values, anyValueToInterface(arrayValue))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return attributesToMap(typedValue.KvlistValue.GetValues())
+	}
+	return nil
+}
+
+// LogsEntryHost returns the _HOSTNAME of a log entry, an empty string if it has none.
+func LogsEntryHost(entry *journal.LogsEntry) string {
+	host, _ := stringAttribute(entry.Log, "_HOSTNAME")
+	return strings.TrimSpace(host)
+}
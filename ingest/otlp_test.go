@@ -0,0 +1,118 @@
+package ingest
+
+import (
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseOtlpContentType(t *testing.T) {
+	contentType, err := ParseOtlpContentType("application/json; charset=utf-8")
+	assert.NoError(t, err)
+	assert.Equal(t, OtlpJsonContentType, contentType)
+
+	_, err = ParseOtlpContentType("text/plain")
+	assert.Error(t, err)
+}
+
+func TestOtlpMetricsToMetricValues(t *testing.T) {
+	now := time.UnixMilli(1723552255000)
+	body := `{"resourceMetrics": [{
+		"resource": {"attributes": [
+			{"key": "host.name", "value": {"stringValue": "server-1"}},
+			{"key": "service.name", "value": {"stringValue": "shop"}}
+		]},
+		"scopeMetrics": [{"metrics": [
+			{"name": "queue_size", "gauge": {"dataPoints": [
+				{"asInt": "3", "timeUnixNano": "1723552250000000000", "attributes": [{"key": "queue", "value": {"stringValue": "mail"}}]},
+				{"asInt": "5", "timeUnixNano": "1723552254000000000", "attributes": [{"key": "queue", "value": {"stringValue": "mail"}}]}
+			]}},
+			{"name": "requests", "sum": {"dataPoints": [{"asDouble": 1.5}], "isMonotonic": true}},
+			{"name": "latency", "histogram": {"dataPoints": [{"count": "1"}]}}
+		]}]
+	}]}`
+
+	request, err := DecodeOtlpMetrics([]byte(body), OtlpJsonContentType)
+	assert.NoError(t, err)
+	metrics, skipped := OtlpMetricsToMetricValues(request, now)
+
+	assert.Equal(t, 2, skipped)
+	assert.Equal(t, []MetricValues{
+		{
+			Host:      "server-1",
+			Name:      `queue_size{queue="mail"}`,
+			Type:      Gauge,
+			Timestamp: time.UnixMilli(1723552254000),
+			Value:     "5",
+			Labels:    map[string]string{"service.name": "shop", "queue": "mail"},
+		},
+		{
+			Host:      "server-1",
+			Name:      "requests",
+			Type:      Gauge,
+			Timestamp: now,
+			Value:     "1.5",
+			Labels:    map[string]string{"service.name": "shop"},
+		},
+	}, metrics)
+}
+
+func TestOtlpLogsToLogsEntries(t *testing.T) {
+	now := time.UnixMilli(1723552255000)
+	body := `{"resourceLogs": [{
+		"resource": {"attributes": [
+			{"key": "host.name", "value": {"stringValue": "server-1"}},
+			{"key": "service.name", "value": {"stringValue": "shop"}}
+		]},
+		"scopeLogs": [{"logRecords": [{
+			"timeUnixNano": "1723552250000000000",
+			"severityNumber": 17,
+			"severityText": "ERROR",
+			"body": {"stringValue": "payment failed"},
+			"traceId": "5b8efff798038103d269b633813fc60c",
+			"attributes": [{"key": "order", "value": {"intValue": "42"}}]
+		}]}]
+	}]}`
+
+	request, err := DecodeOtlpLogs([]byte(body), OtlpJsonContentType)
+	assert.NoError(t, err)
+	entries, err := OtlpLogsToLogsEntries(request, now)
+
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	entry := entries[0]
+	assert.True(t, time.UnixMilli(1723552250000).Equal(entry.Time))
+	assert.NotEmpty(t, entry.Hash)
+	assert.Equal(t, "server-1", LogsEntryHost(entry))
+	assert.Equal(t, "payment failed", entry.Log["MESSAGE"])
+	assert.Equal(t, "3", entry.Log["PRIORITY"])
+	assert.Equal(t, "shop", entry.Log["SYSLOG_IDENTIFIER"])
+	assert.Equal(t, "5b8efff798038103d269b633813fc60c", entry.Log["TRACE_ID"])
+	assert.Equal(t, map[string]any{"order": int64(42)}, entry.Log["attributes"])
+}
+
+func TestOtlpLogsWithoutResourceAttributes(t *testing.T) {
+	now := time.UnixMilli(1723552255000)
+
+	t.Run("should leave out the missing and the non-string resource attributes", func(t *testing.T) {
+		// arrange
+		body := `{"resourceLogs": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"intValue": "1"}}]},
+			"scopeLogs": [{"logRecords": [{"body": {"stringValue": "started"}}]}]
+		}]}`
+		request, err := DecodeOtlpLogs([]byte(body), OtlpJsonContentType)
+		assert.NoError(t, err)
+
+		// act
+		entries, err := OtlpLogsToLogsEntries(request, now)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+		assert.NotContains(t, entries[0].Log, "_HOSTNAME")
+		assert.NotContains(t, entries[0].Log, "SYSLOG_IDENTIFIER")
+		assert.NotContains(t, entries[0].Log, "PRIORITY")
+		assert.Equal(t, "", LogsEntryHost(entries[0]))
+	})
+}
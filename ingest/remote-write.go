@@ -0,0 +1,170 @@
+package ingest
+
+import (
+	"fmt"
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"time"
+)
+
+// Field numbers of the Prometheus remote write protobuf messages, see
+// https://github.com/prometheus/prometheus/blob/main/prompb/types.proto
+const (
+	writeRequestTimeseries = 1
+	timeSeriesLabels       = 1
+	timeSeriesSamples      = 2
+	labelName              = 1
+	labelValue             = 2
+	sampleValue            = 1
+	sampleTimestamp        = 2
+)
+
+const metricNameLabel = "__name__"
+
+// DecodeWriteRequest decodes a snappy compressed remote write WriteRequest. Only the newest
+// sample of every series is returned, because a metric only stores its latest value.
+func DecodeWriteRequest(compressed []byte, maxDecodedSize int) ([]Series, error) {
+	decodedSize, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy data: %w", err)
+	}
+	if maxDecodedSize > 0 && decodedSize > maxDecodedSize {
+		return nil, fmt.Errorf("decoded write request is %v bytes, at most %v are allowed", decodedSize, maxDecodedSize)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snappy data: %w", err)
+	}
+	return parseWriteRequest(data)
+}
+
+func parseWriteRequest(data []byte) ([]Series, error) {
+	seriesList := make([]Series, 0)
+	err := forEachField(data, func(number protowire.Number, fieldType protowire.Type, value []byte) error {
+		if number != writeRequestTimeseries || fieldType != protowire.BytesType {
+			return nil
+		}
+		series, hasSample, err := parseTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		if hasSample {
+			seriesList = append(seriesList, series)
+		}
+		return nil
+	})
+	return seriesList, err
+}
+
+func parseTimeSeries(data []byte) (Series, bool, error) {
+	series := Series{Labels: map[string]string{}}
+	hasSample := false
+	err := forEachField(data, func(number protowire.Number, fieldType protowire.Type, value []byte) error {
+		if fieldType != protowire.BytesType {
+			return nil
+		}
+		switch number {
+		case timeSeriesLabels:
+			name, text, err := parseLabel(value)
+			if err != nil {
+				return err
+			}
+			if name == metricNameLabel {
+				series.Name = text
+			} else {
+				series.Labels[name] = text
+			}
+		case timeSeriesSamples:
+			sample, timestamp, err := parseSample(value)
+			if err != nil {
+				return err
+			}
+			// NaN marks a stale series in Prometheus
+			if math.IsNaN(sample) {
+				return nil
+			}
+			if !hasSample || timestamp.After(series.Timestamp) {
+				series.Value = sample
+				series.Timestamp = timestamp
+				hasSample = true
+			}
+		}
+		return nil
+	})
+	if err == nil && series.Name == "" {
+		err = fmt.Errorf("time series without %v label", metricNameLabel)
+	}
+	return series, hasSample, err
+}
+
+func parseLabel(data []byte) (string, string, error) {
+	var name, value string
+	err := forEachField(data, func(number protowire.Number, fieldType protowire.Type, fieldValue []byte) error {
+		if fieldType != protowire.BytesType {
+			return nil
+		}
+		switch number {
+		case labelName:
+			name = string(fieldValue)
+		case labelValue:
+			value = string(fieldValue)
+		}
+		return nil
+	})
+	return name, value, err
+}
+
+func parseSample(data []byte) (float64, time.Time, error) {
+	var value float64
+	var timestamp int64
+	err := forEachField(data, func(number protowire.Number, fieldType protowire.Type, fieldValue []byte) error {
+		switch {
+		case number == sampleValue && fieldType == protowire.Fixed64Type:
+			bits, n := protowire.ConsumeFixed64(fieldValue)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value = math.Float64frombits(bits)
+		case number == sampleTimestamp && fieldType == protowire.VarintType:
+			varint, n := protowire.ConsumeVarint(fieldValue)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			timestamp = int64(varint)
+		}
+		return nil
+	})
+	return value, time.UnixMilli(timestamp), err
+}
+
+// forEachField calls handle for every field of a protobuf message. For length delimited fields
+// the value is the content, for all other fields the raw encoded value.
+func forEachField(data []byte, handle func(number protowire.Number, fieldType protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		number, fieldType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		valueLength := protowire.ConsumeFieldValue(number, fieldType, data)
+		if valueLength < 0 {
+			return protowire.ParseError(valueLength)
+		}
+		value := data[:valueLength]
+		if fieldType == protowire.BytesType {
+			content, n := protowire.ConsumeBytes(value)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value = content
+		}
+		err := handle(number, fieldType, value)
+		if err != nil {
+			return err
+		}
+		data = data[valueLength:]
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"testing"
+	"time"
+)
+
+type testSample struct {
+	value     float64
+	timestamp int64
+}
+
+func encodeTimeSeries(labels [][2]string, samples []testSample) []byte {
+	var timeSeries []byte
+	for _, label := range labels {
+		var encodedLabel []byte
+		encodedLabel = protowire.AppendTag(encodedLabel, labelName, protowire.BytesType)
+		encodedLabel = protowire.AppendString(encodedLabel, label[0])
+		encodedLabel = protowire.AppendTag(encodedLabel, labelValue, protowire.BytesType)
+		encodedLabel = protowire.AppendString(encodedLabel, label[1])
+		timeSeries = protowire.AppendTag(timeSeries, timeSeriesLabels, protowire.BytesType)
+		timeSeries = protowire.AppendBytes(timeSeries, encodedLabel)
+	}
+	for _, sample := range samples {
+		var encodedSample []byte
+		encodedSample = protowire.AppendTag(encodedSample, sampleValue, protowire.Fixed64Type)
+		encodedSample = protowire.AppendFixed64(encodedSample, math.Float64bits(sample.value))
+		encodedSample = protowire.AppendTag(encodedSample, sampleTimestamp, protowire.VarintType)
+		encodedSample = protowire.AppendVarint(encodedSample, uint64(sample.timestamp))
+		timeSeries = protowire.AppendTag(timeSeries, timeSeriesSamples, protowire.BytesType)
+		timeSeries = protowire.AppendBytes(timeSeries, encodedSample)
+	}
+	return timeSeries
+}
+
+func encodeWriteRequest(timeSeries ...[]byte) []byte {
+	var writeRequest []byte
+	for _, series := range timeSeries {
+		writeRequest = protowire.AppendTag(writeRequest, writeRequestTimeseries, protowire.BytesType)
+		writeRequest = protowire.AppendBytes(writeRequest, series)
+	}
+	return snappy.Encode(nil, writeRequest)
+}
+
+func TestDecodeWriteRequest(t *testing.T) {
+	t.Run("should decode the newest sample of every series", func(t *testing.T) {
+		body := encodeWriteRequest(
+			encodeTimeSeries(
+				[][2]string{{"__name__", "node_load1"}, {"instance", "server-1:9100"}, {"job", "node"}},
+				[]testSample{{value: 0.5, timestamp: 1723552255000}, {value: 0.7, timestamp: 1723552256000}, {value: 0.1, timestamp: 1723552254000}},
+			),
+			encodeTimeSeries(
+				[][2]string{{"__name__", "up"}, {"instance", "server-2:9100"}},
+				[]testSample{{value: 1, timestamp: 1723552255000}},
+			),
+		)
+
+		series, err := DecodeWriteRequest(body, 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Series{
+			{
+				Name:      "node_load1",
+				Labels:    map[string]string{"instance": "server-1:9100", "job": "node"},
+				Value:     0.7,
+				Timestamp: time.UnixMilli(1723552256000),
+			},
+			{
+				Name:      "up",
+				Labels:    map[string]string{"instance": "server-2:9100"},
+				Value:     1,
+				Timestamp: time.UnixMilli(1723552255000),
+			},
+		}, series)
+	})
+
+	t.Run("should skip series that only have stale markers", func(t *testing.T) {
+		body := encodeWriteRequest(encodeTimeSeries(
+			[][2]string{{"__name__", "up"}, {"instance", "server-1:9100"}},
+			[]testSample{{value: math.NaN(), timestamp: 1723552255000}},
+		))
+
+		series, err := DecodeWriteRequest(body, 0)
+
+		assert.NoError(t, err)
+		assert.Empty(t, series)
+	})
+
+	t.Run("should reject requests that are too large when decoded", func(t *testing.T) {
+		body := encodeWriteRequest(encodeTimeSeries(
+			[][2]string{{"__name__", "up"}, {"instance", "server-1:9100"}},
+			[]testSample{{value: 1, timestamp: 1723552255000}},
+		))
+
+		_, err := DecodeWriteRequest(body, 10)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should fail on invalid data", func(t *testing.T) {
+		_, err := DecodeWriteRequest(snappy.Encode(nil, []byte{0x0a, 0xff}), 0)
+		assert.Error(t, err)
+	})
+}
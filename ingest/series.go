@@ -0,0 +1,164 @@
+package ingest
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/gorlug/metrics-backend/metrics"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Series is a single value of a named and labeled time series, as it is sent by Prometheus
+// or Telegraf.
+type Series struct {
+	Name      string
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+type SeriesRule struct {
+	// Match is a regular expression that has to match the whole series name. An empty Match
+	// matches every series.
+	Match string `json:"match"`
+	// HostLabel is the label that contains the host name of the metric.
+	HostLabel string `json:"hostLabel"`
+	// NameLabels are appended to the series name to build the metric name. If it is not set
+	// all labels except the host label are used.
+	NameLabels []string `json:"nameLabels"`
+	// Type of the created metric, the default is gauge.
+	Type MetricType `json:"type"`
+	// Drop discards the matching series.
+	Drop bool `json:"drop"`
+
+	matchRegexp *regexp.Regexp
+}
+
+// SeriesMapper converts series into metrics with the first matching rule. Series that
+// do not match any rule are dropped.
+type SeriesMapper struct {
+	rules []SeriesRule
+}
+
+// NewSeriesMapper creates a mapper for the rules. If no rules are given every series is stored
+// with the default host label.
+func NewSeriesMapper(rules []SeriesRule, defaultHostLabel string) (*SeriesMapper, error) {
+	if len(rules) == 0 {
+		rules = []SeriesRule{{}}
+	}
+	for i := range rules {
+		rule := &rules[i]
+		if rule.HostLabel == "" {
+			rule.HostLabel = defaultHostLabel
+		}
+		if rule.Type == "" {
+			rule.Type = Gauge
+		}
+		if !IsValidMetricType(string(rule.Type)) {
+			return nil, fmt.Errorf("rule %v: invalid metric type %v", i, rule.Type)
+		}
+		if rule.Match != "" {
+			matchRegexp, err := regexp.Compile("^(?:" + rule.Match + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("rule %v: %w", i, err)
+			}
+			rule.matchRegexp = matchRegexp
+		}
+	}
+	return &SeriesMapper{rules: rules}, nil
+}
+
+// LoadSeriesMapper reads the rules from a JSON file. An empty path uses the default rules.
+func LoadSeriesMapper(rulesFile string, defaultHostLabel string) (*SeriesMapper, error) {
+	var rules []SeriesRule
+	if rulesFile != "" {
+		content, err := os.ReadFile(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(content, &rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse rules file %v: %w", rulesFile, err)
+		}
+	}
+	return NewSeriesMapper(rules, defaultHostLabel)
+}
+
+// Map returns false if the series is dropped.
+func (m *SeriesMapper) Map(series Series) (MetricValues, bool) {
+	for _, rule := range m.rules {
+		if rule.matchRegexp != nil && !rule.matchRegexp.MatchString(series.Name) {
+			continue
+		}
+		if rule.Drop {
+			return MetricValues{}, false
+		}
+		return rule.toMetricValues(series)
+	}
+	return MetricValues{}, false
+}
+
+func (r *SeriesRule) toMetricValues(series Series) (MetricValues, bool) {
+	host, exists := series.Labels[r.HostLabel]
+	if !exists || host == "" {
+		return MetricValues{}, false
+	}
+
+	labels := map[string]string{}
+	for key, value := range series.Labels {
+		if key != r.HostLabel {
+			labels[key] = value
+		}
+	}
+	nameLabels := r.NameLabels
+	if nameLabels == nil {
+		nameLabels = make([]string, 0, len(labels))
+		for key := range labels {
+			nameLabels = append(nameLabels, key)
+		}
+		sort.Strings(nameLabels)
+	}
+
+	metric := MetricValues{
+		Host:      stripPort(host),
+		Name:      FormatSeriesName(series.Name, labels, nameLabels),
+		Type:      r.Type,
+		Timestamp: series.Timestamp,
+		Labels:    labels,
+	}
+	// the value of a ping metric are the minutes till it alerts, not a measurement
+	if r.Type != Ping {
+		metric.Value = strconv.FormatFloat(series.Value, 'f', -1, 64)
+	}
+	return metric, true
+}
+
+// FormatSeriesName appends the given labels to the name in the Prometheus notation,
+// e.g. node_filesystem_avail_bytes{mountpoint="/"}.
+func FormatSeriesName(name string, labels map[string]string, nameLabels []string) string {
+	formatted := make([]string, 0, len(nameLabels))
+	for _, key := range nameLabels {
+		value, exists := labels[key]
+		if !exists {
+			continue
+		}
+		formatted = append(formatted, fmt.Sprintf("%v=%q", key, value))
+	}
+	if len(formatted) == 0 {
+		return name
+	}
+	return name + "{" + strings.Join(formatted, ",") + "}"
+}
+
+func stripPort(host string) string {
+	hostWithoutPort, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	return hostWithoutPort
+}
@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSeriesMapper(t *testing.T) {
+	timestamp := time.UnixMilli(1723552255000)
+	series := Series{
+		Name:      "node_filesystem_avail_bytes",
+		Labels:    map[string]string{"instance": "server-1:9100", "mountpoint": "/", "device": "/dev/sda1"},
+		Value:     1024,
+		Timestamp: timestamp,
+	}
+
+	t.Run("should use all labels for the name by default", func(t *testing.T) {
+		mapper, err := NewSeriesMapper(nil, "instance")
+		assert.NoError(t, err)
+
+		metric, ok := mapper.Map(series)
+
+		assert.True(t, ok)
+		assert.Equal(t, MetricValues{
+			Host:      "server-1",
+			Name:      `node_filesystem_avail_bytes{device="/dev/sda1",mountpoint="/"}`,
+			Type:      Gauge,
+			Timestamp: timestamp,
+			Value:     "1024",
+			Labels:    map[string]string{"mountpoint": "/", "device": "/dev/sda1"},
+		}, metric)
+	})
+
+	t.Run("should use the first matching rule", func(t *testing.T) {
+		mapper, err := NewSeriesMapper([]SeriesRule{
+			{Match: "node_load.*", Drop: true},
+			{Match: "node_filesystem_.*", NameLabels: []string{"mountpoint"}, Type: Disk},
+			{Match: ".*", Drop: true},
+		}, "instance")
+		assert.NoError(t, err)
+
+		metric, ok := mapper.Map(series)
+
+		assert.True(t, ok)
+		assert.Equal(t, `node_filesystem_avail_bytes{mountpoint="/"}`, metric.Name)
+		assert.Equal(t, Disk, metric.Type)
+
+		_, ok = mapper.Map(Series{Name: "node_load1", Labels: map[string]string{"instance": "server-1"}})
+		assert.False(t, ok)
+	})
+
+	t.Run("should drop series without host and series no rule matches", func(t *testing.T) {
+		mapper, err := NewSeriesMapper([]SeriesRule{{Match: "node_.*"}}, "instance")
+		assert.NoError(t, err)
+
+		_, ok := mapper.Map(Series{Name: "node_load1", Labels: map[string]string{}})
+		assert.False(t, ok)
+		_, ok = mapper.Map(Series{Name: "up", Labels: map[string]string{"instance": "server-1"}})
+		assert.False(t, ok)
+	})
+
+	t.Run("should not store the value of ping metrics", func(t *testing.T) {
+		mapper, err := NewSeriesMapper([]SeriesRule{{Match: "up", Type: Ping, NameLabels: []string{}}}, "instance")
+		assert.NoError(t, err)
+
+		metric, ok := mapper.Map(Series{Name: "up", Labels: map[string]string{"instance": "server-1"}, Value: 1})
+
+		assert.True(t, ok)
+		assert.Equal(t, "up", metric.Name)
+		assert.Equal(t, "", metric.Value)
+	})
+
+	t.Run("should reject invalid rules", func(t *testing.T) {
+		_, err := NewSeriesMapper([]SeriesRule{{Match: "("}}, "instance")
+		assert.Error(t, err)
+		_, err = NewSeriesMapper([]SeriesRule{{Type: "cpu"}}, "instance")
+		assert.Error(t, err)
+	})
+}
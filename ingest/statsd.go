@@ -0,0 +1,370 @@
+package ingest
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/gorlug/metrics-backend/stats"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var statsdPacketsTotal = stats.NewCounter("metrics_backend_statsd_packets_total", "Number of received StatsD packets.")
+var statsdInvalidLinesTotal = stats.NewCounter("metrics_backend_statsd_invalid_lines_total", "Number of StatsD lines that could not be parsed.")
+
+const statsdHostTag = "host"
+
+// statsdGaugeIdleFlushes is the number of flush intervals after which a gauge that was not
+// updated is forgotten. A delta after that starts from 0 again.
+const statsdGaugeIdleFlushes = 60
+
+type StatsdType string
+
+const (
+	StatsdGauge   StatsdType = "g"
+	StatsdCounter StatsdType = "c"
+	StatsdTimer   StatsdType = "ms"
+	// histograms and distributions of DogStatsD are aggregated like timers
+	StatsdHistogram    StatsdType = "h"
+	StatsdDistribution StatsdType = "d"
+)
+
+type StatsdLine struct {
+	Name       string
+	Values     []float64
+	Type       StatsdType
+	SampleRate float64
+	Tags       map[string]string
+	// GaugeDelta is set if a gauge value has a sign and changes the current value
+	GaugeDelta bool
+}
+
+// ParseStatsdLine parses a line like "page.views:1|c|@0.5|#host:server-1,env:prod".
+func ParseStatsdLine(line string) (StatsdLine, error) {
+	parsed := StatsdLine{SampleRate: 1, Tags: map[string]string{}}
+	name, rest, found := strings.Cut(line, ":")
+	if !found || name == "" {
+		return parsed, fmt.Errorf("missing metric name in %q", line)
+	}
+	parsed.Name = name
+
+	sections := strings.Split(rest, "|")
+	if len(sections) < 2 {
+		return parsed, fmt.Errorf("missing metric type in %q", line)
+	}
+	parsed.Type = StatsdType(sections[1])
+	switch parsed.Type {
+	case StatsdGauge, StatsdCounter, StatsdTimer, StatsdHistogram, StatsdDistribution:
+	default:
+		return parsed, fmt.Errorf("unsupported metric type %q in %q", sections[1], line)
+	}
+
+	for _, valueString := range strings.Split(sections[0], ":") {
+		value, err := strconv.ParseFloat(valueString, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return parsed, fmt.Errorf("invalid value %q in %q", valueString, line)
+		}
+		if parsed.Type == StatsdGauge && (strings.HasPrefix(valueString, "+") || strings.HasPrefix(valueString, "-")) {
+			parsed.GaugeDelta = true
+		}
+		parsed.Values = append(parsed.Values, value)
+	}
+
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			sampleRate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || sampleRate <= 0 || sampleRate > 1 {
+				return parsed, fmt.Errorf("invalid sample rate %q in %q", section, line)
+			}
+			parsed.SampleRate = sampleRate
+		case strings.HasPrefix(section, "#"):
+			for _, tag := range strings.Split(section[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				key, value, _ := strings.Cut(tag, ":")
+				parsed.Tags[key] = value
+			}
+		}
+	}
+	return parsed, nil
+}
+
+type statsdAggregate struct {
+	host    string
+	name    string
+	labels  map[string]string
+	kind    StatsdType
+	value   float64
+	timings []statsdTiming
+}
+
+type statsdTiming struct {
+	value      float64
+	sampleRate float64
+}
+
+type statsdGauge struct {
+	value float64
+	// flush is the number of the flush interval of the last update
+	flush int
+}
+
+// StatsdAggregator collects the StatsD values of one flush interval.
+type StatsdAggregator struct {
+	mutex      sync.Mutex
+	aggregates map[string]*statsdAggregate
+	// gauges keeps the last value of every gauge so that deltas can be applied
+	gauges  map[string]statsdGauge
+	flushes int
+}
+
+func NewStatsdAggregator() *StatsdAggregator {
+	return &StatsdAggregator{aggregates: map[string]*statsdAggregate{}, gauges: map[string]statsdGauge{}}
+}
+
+// Add aggregates a line. The host is taken from the host tag, otherwise the source host is used.
+func (a *StatsdAggregator) Add(line StatsdLine, sourceHost string) {
+	host := sourceHost
+	labels := map[string]string{}
+	for key, value := range line.Tags {
+		if key == statsdHostTag && value != "" {
+			host = value
+			continue
+		}
+		labels[key] = value
+	}
+	name := FormatSeriesName(line.Name, labels, sortedLabelKeys(labels))
+	kind := line.Type
+	if kind == StatsdHistogram || kind == StatsdDistribution {
+		kind = StatsdTimer
+	}
+	key := strings.Join([]string{host, name, string(kind)}, "\xff")
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	aggregate, exists := a.aggregates[key]
+	if !exists {
+		aggregate = &statsdAggregate{host: host, name: name, labels: labels, kind: kind}
+		a.aggregates[key] = aggregate
+	}
+	for _, value := range line.Values {
+		switch kind {
+		case StatsdCounter:
+			aggregate.value += value / line.SampleRate
+		case StatsdGauge:
+			gauge := a.gauges[key]
+			if line.GaugeDelta {
+				gauge.value += value
+			} else {
+				gauge.value = value
+			}
+			gauge.flush = a.flushes
+			a.gauges[key] = gauge
+			aggregate.value = gauge.value
+		case StatsdTimer:
+			aggregate.timings = append(aggregate.timings, statsdTiming{value: value, sampleRate: line.SampleRate})
+		}
+	}
+}
+
+// Flush returns the metrics of the current interval and starts a new one. Gauges that were not
+// updated for statsdGaugeIdleFlushes intervals are forgotten.
+func (a *StatsdAggregator) Flush(timestamp time.Time) []MetricValues {
+	a.mutex.Lock()
+	aggregates := a.aggregates
+	a.aggregates = map[string]*statsdAggregate{}
+	a.flushes++
+	for key, gauge := range a.gauges {
+		if a.flushes-gauge.flush > statsdGaugeIdleFlushes {
+			delete(a.gauges, key)
+		}
+	}
+	a.mutex.Unlock()
+
+	keys := make([]string, 0, len(aggregates))
+	for key := range aggregates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	metrics := make([]MetricValues, 0, len(aggregates))
+	for _, key := range keys {
+		aggregate := aggregates[key]
+		if aggregate.kind != StatsdTimer {
+			metrics = append(metrics, aggregate.toMetricValues(aggregate.name, aggregate.value, timestamp))
+			continue
+		}
+		for _, summary := range summarizeTimings(aggregate.timings) {
+			metrics = append(metrics, aggregate.toMetricValues(aggregate.name+"."+summary.suffix, summary.value, timestamp))
+		}
+	}
+	return metrics
+}
+
+func (a *statsdAggregate) toMetricValues(name string, value float64, timestamp time.Time) MetricValues {
+	return MetricValues{
+		Host:      a.host,
+		Name:      name,
+		Type:      Gauge,
+		Timestamp: timestamp,
+		Value:     strconv.FormatFloat(value, 'f', -1, 64),
+		Labels:    a.labels,
+	}
+}
+
+type timingSummary struct {
+	suffix string
+	value  float64
+}
+
+// summarizeTimings scales the count by the sample rates like the counters, the other values are
+// calculated from the received timings.
+func summarizeTimings(timings []statsdTiming) []timingSummary {
+	sorted := make([]float64, 0, len(timings))
+	sum, count := 0.0, 0.0
+	for _, timing := range timings {
+		sorted = append(sorted, timing.value)
+		sum += timing.value
+		count += 1 / timing.sampleRate
+	}
+	sort.Float64s(sorted)
+	p95Index := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	return []timingSummary{
+		{suffix: "count", value: count},
+		{suffix: "min", value: sorted[0]},
+		{suffix: "max", value: sorted[len(sorted)-1]},
+		{suffix: "mean", value: sum / float64(len(sorted))},
+		{suffix: "p95", value: sorted[p95Index]},
+	}
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// StatsdListener receives StatsD packets via UDP and saves the aggregated values every flush interval.
+type StatsdListener struct {
+	connection     net.PacketConn
+	aggregator     *StatsdAggregator
+	metricsService MetricsService
+	flushInterval  time.Duration
+	done           chan struct{}
+	wait           sync.WaitGroup
+}
+
+func NewStatsdListener(address string, flushInterval time.Duration, metricsService MetricsService) (*StatsdListener, error) {
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("the StatsD flush interval must be positive, got %v", flushInterval)
+	}
+	connection, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsdListener{
+		connection:     connection,
+		aggregator:     NewStatsdAggregator(),
+		metricsService: metricsService,
+		flushInterval:  flushInterval,
+		done:           make(chan struct{}),
+	}, nil
+}
+
+func (l *StatsdListener) Start() {
+	log.Printf("StatsD listener is running on %v", l.connection.LocalAddr())
+	l.wait.Add(2)
+	go l.receive()
+	go l.flushPeriodically()
+}
+
+func (l *StatsdListener) Close() {
+	close(l.done)
+	err := l.connection.Close()
+	if err != nil {
+		log.Println("failed to close StatsD listener", err)
+	}
+	l.wait.Wait()
+	l.flush()
+}
+
+func (l *StatsdListener) receive() {
+	defer l.wait.Done()
+	buffer := make([]byte, 65535)
+	for {
+		n, address, err := l.connection.ReadFrom(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Println("failed to read StatsD packet", err)
+			continue
+		}
+		statsdPacketsTotal.Inc()
+		l.handlePacket(string(buffer[:n]), sourceHost(address))
+	}
+}
+
+func (l *StatsdListener) handlePacket(packet string, sourceHost string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		parsed, err := ParseStatsdLine(line)
+		if err != nil {
+			log.Println("failed to parse StatsD line", err)
+			statsdInvalidLinesTotal.Inc()
+			continue
+		}
+		l.aggregator.Add(parsed, sourceHost)
+	}
+}
+
+func (l *StatsdListener) flushPeriodically() {
+	defer l.wait.Done()
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+			l.flush()
+		}
+	}
+}
+
+func (l *StatsdListener) flush() {
+	writer := NewMetricWriter(l.metricsService, func(string) bool {
+		return true
+	})
+	for _, metric := range l.aggregator.Flush(time.Now()) {
+		err := writer.Write(metric)
+		if err != nil {
+			log.Println("failed to save StatsD metric", err)
+		}
+	}
+	if writer.Result != (IngestResult{}) {
+		log.Printf("flushed StatsD metrics: %+v", writer.Result)
+	}
+}
+
+func sourceHost(address net.Addr) string {
+	udpAddress, ok := address.(*net.UDPAddr)
+	if !ok {
+		return stripPort(address.String())
+	}
+	return udpAddress.IP.String()
+}
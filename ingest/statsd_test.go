@@ -0,0 +1,133 @@
+package ingest
+
+import (
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatsdLine(t *testing.T) {
+	t.Run("should parse a counter with sample rate and tags", func(t *testing.T) {
+		line, err := ParseStatsdLine("page.views:2|c|@0.5|#host:server-1,env:prod,canary")
+		assert.NoError(t, err)
+		assert.Equal(t, StatsdLine{
+			Name:       "page.views",
+			Values:     []float64{2},
+			Type:       StatsdCounter,
+			SampleRate: 0.5,
+			Tags:       map[string]string{"host": "server-1", "env": "prod", "canary": ""},
+		}, line)
+	})
+
+	t.Run("should parse gauge deltas and multiple values", func(t *testing.T) {
+		line, err := ParseStatsdLine("queue.size:-3|g")
+		assert.NoError(t, err)
+		assert.True(t, line.GaugeDelta)
+
+		line, err = ParseStatsdLine("request.time:10:20|ms")
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{10, 20}, line.Values)
+	})
+
+	t.Run("should reject invalid lines", func(t *testing.T) {
+		for _, invalid := range []string{"no-value", "name:1", "name:abc|c", "name:1|s", "name:1|c|@2", ":1|c"} {
+			_, err := ParseStatsdLine(invalid)
+			assert.Error(t, err, invalid)
+		}
+	})
+}
+
+func TestStatsdAggregator(t *testing.T) {
+	timestamp := time.UnixMilli(1723552255000)
+	parse := func(line string) StatsdLine {
+		parsed, err := ParseStatsdLine(line)
+		assert.NoError(t, err)
+		return parsed
+	}
+
+	t.Run("should sum up counters and use the host tag", func(t *testing.T) {
+		aggregator := NewStatsdAggregator()
+		aggregator.Add(parse("jobs:1|c|#host:server-1"), "10.0.0.1")
+		aggregator.Add(parse("jobs:1|c|@0.5|#host:server-1"), "10.0.0.1")
+
+		assert.Equal(t, []MetricValues{
+			{Host: "server-1", Name: "jobs", Type: Gauge, Timestamp: timestamp, Value: "3", Labels: map[string]string{}},
+		}, aggregator.Flush(timestamp))
+		assert.Empty(t, aggregator.Flush(timestamp))
+	})
+
+	t.Run("should keep gauge values for deltas and add tags to the name", func(t *testing.T) {
+		aggregator := NewStatsdAggregator()
+		aggregator.Add(parse("queue:10|g|#queue:mail"), "10.0.0.1")
+		aggregator.Flush(timestamp)
+		aggregator.Add(parse("queue:-3|g|#queue:mail"), "10.0.0.1")
+
+		assert.Equal(t, []MetricValues{
+			{Host: "10.0.0.1", Name: `queue{queue="mail"}`, Type: Gauge, Timestamp: timestamp, Value: "7", Labels: map[string]string{"queue": "mail"}},
+		}, aggregator.Flush(timestamp))
+	})
+
+	t.Run("should forget gauges that were not updated for a while", func(t *testing.T) {
+		aggregator := NewStatsdAggregator()
+		aggregator.Add(parse("queue:10|g"), "10.0.0.1")
+		aggregator.Add(parse("active:5|g"), "10.0.0.1")
+		for i := 0; i < statsdGaugeIdleFlushes; i++ {
+			aggregator.Add(parse("active:+1|g"), "10.0.0.1")
+			aggregator.Flush(timestamp)
+		}
+		assert.Len(t, aggregator.gauges, 2)
+
+		aggregator.Flush(timestamp)
+		aggregator.Add(parse("queue:+1|g"), "10.0.0.1")
+
+		assert.Len(t, aggregator.gauges, 2)
+		assert.Equal(t, float64(1), aggregator.gauges[statsdTestKey("10.0.0.1", "queue", StatsdGauge)].value)
+		assert.Equal(t, float64(5+statsdGaugeIdleFlushes), aggregator.gauges[statsdTestKey("10.0.0.1", "active", StatsdGauge)].value)
+	})
+
+	t.Run("should summarize timers", func(t *testing.T) {
+		aggregator := NewStatsdAggregator()
+		aggregator.Add(parse("request:30:10|ms"), "10.0.0.1")
+		aggregator.Add(parse("request:20|h"), "10.0.0.1")
+
+		values := map[string]string{}
+		for _, metric := range aggregator.Flush(timestamp) {
+			values[metric.Name] = metric.Value
+		}
+		assert.Equal(t, map[string]string{
+			"request.count": "3",
+			"request.min":   "10",
+			"request.max":   "30",
+			"request.mean":  "20",
+			"request.p95":   "30",
+		}, values)
+	})
+
+	t.Run("should scale the timer count by the sample rate", func(t *testing.T) {
+		aggregator := NewStatsdAggregator()
+		aggregator.Add(parse("request:30|ms|@0.1"), "10.0.0.1")
+		aggregator.Add(parse("request:10|ms|@0.5"), "10.0.0.1")
+
+		values := map[string]string{}
+		for _, metric := range aggregator.Flush(timestamp) {
+			values[metric.Name] = metric.Value
+		}
+		assert.Equal(t, "12", values["request.count"])
+		assert.Equal(t, "20", values["request.mean"])
+	})
+}
+
+func statsdTestKey(host string, name string, kind StatsdType) string {
+	return strings.Join([]string{host, name, string(kind)}, "\xff")
+}
+
+func TestNewStatsdListener(t *testing.T) {
+	t.Run("should reject a flush interval that is not positive", func(t *testing.T) {
+		for _, flushInterval := range []time.Duration{0, -time.Second} {
+			_, err := NewStatsdListener("127.0.0.1:0", flushInterval, nil)
+			assert.Error(t, err, flushInterval)
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package journal
+
+import (
+	"regexp"
+	"sort"
+)
+
+// TextPart is a part of a text in the journal table, Match is true for the parts that matched
+// the message search of the query.
+type TextPart struct {
+	Text  string
+	Match bool
+}
+
+// HighlightText splits the text into the parts that match one of the patterns and the parts in
+// between. Overlapping matches are merged.
+func HighlightText(text string, patterns []*regexp.Regexp) []TextPart {
+	ranges := make([][]int, 0)
+	for _, pattern := range patterns {
+		for _, match := range pattern.FindAllStringIndex(text, -1) {
+			if match[1] > match[0] {
+				ranges = append(ranges, match)
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return []TextPart{{Text: text}}
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+
+	parts := make([]TextPart, 0)
+	position := 0
+	for _, match := range ranges {
+		if match[1] <= position {
+			continue
+		}
+		start := max(match[0], position)
+		if start > position {
+			parts = append(parts, TextPart{Text: text[position:start]})
+		} else if len(parts) > 0 && parts[len(parts)-1].Match {
+			parts[len(parts)-1].Text += text[start:match[1]]
+			position = match[1]
+			continue
+		}
+		parts = append(parts, TextPart{Text: text[start:match[1]], Match: true})
+		position = match[1]
+	}
+	if position < len(text) {
+		parts = append(parts, TextPart{Text: text[position:]})
+	}
+	return parts
+}
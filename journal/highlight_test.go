@@ -0,0 +1,49 @@
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestHighlightText(t *testing.T) {
+	t.Run("should split the text at the matches", func(t *testing.T) {
+		// arrange
+		query, err := ParseQuery(`Time* "connection refused" AND NOT MESSAGE~upstream`)
+		assert.NoError(t, err)
+
+		// act
+		parts := HighlightText("upstream timed out, connection refused", query.MessagePatterns())
+
+		// assert
+		assert.Equal(t, []TextPart{
+			{Text: "upstream "},
+			{Text: "time", Match: true},
+			{Text: "d out, "},
+			{Text: "connection refused", Match: true},
+		}, parts)
+	})
+
+	t.Run("should merge overlapping matches", func(t *testing.T) {
+		// arrange
+		patterns := []*regexp.Regexp{regexp.MustCompile("conn"), regexp.MustCompile("nection"), regexp.MustCompile("refused")}
+
+		// act
+		parts := HighlightText("connection refused", patterns)
+
+		// assert
+		assert.Equal(t, []TextPart{
+			{Text: "connection", Match: true},
+			{Text: " "},
+			{Text: "refused", Match: true},
+		}, parts)
+	})
+
+	t.Run("should return the whole text without matches", func(t *testing.T) {
+		// act
+		parts := HighlightText("container started", nil)
+
+		// assert
+		assert.Equal(t, []TextPart{{Text: "container started"}}, parts)
+	})
+}
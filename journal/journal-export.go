@@ -0,0 +1,164 @@
+package journal
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/jackc/pgx/v5"
+	"io"
+	"strings"
+	"time"
+)
+
+const exportFetchSize = 1000
+
+// DefaultExportFields are the columns of a CSV export. time is the time of the log entry, the
+// other fields are read from the log.
+var DefaultExportFields = []string{"time", "_HOSTNAME", "CONTAINER_NAME", "SYSLOG_IDENTIFIER", "PRIORITY", "MESSAGE"}
+
+// ExportLogs passes all logs that match the filters of the data to write. The logs are fetched
+// in batches from a database cursor, so that large exports are not held in memory. Limit and
+// Cursor of the data are ignored.
+func (s *JournalLogService) ExportLogs(ctx context.Context, data *LogPageData, write func(entry LogsEntry) error) error {
+	sql, args, err := logExportSql(data)
+	if err != nil {
+		return err
+	}
+	return pgx.BeginTxFunc(ctx, s.connPool, pgx.TxOptions{AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, "declare logs_export no scroll cursor for "+sql, args...)
+		if err != nil {
+			return err
+		}
+		for {
+			rows, err := tx.Query(ctx, fmt.Sprintf("fetch forward %d from logs_export", exportFetchSize))
+			entries, err := rowsToLogsEntryArray(err, rows)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if err := write(entry); err != nil {
+					return err
+				}
+			}
+			if len(entries) < exportFetchSize {
+				return nil
+			}
+		}
+	})
+}
+
+func logExportSql(data *LogPageData) (string, []any, error) {
+	return goqu.Dialect("postgres").From("logs").
+		Prepared(true).
+		Select("id", "time", "hash", "log").
+		Where(logPageFilter(data)).
+		Order(logOrder(data.Descending)...).
+		ToSQL()
+}
+
+type LogExporter interface {
+	ContentType() string
+	Write(entry LogsEntry) error
+	Flush() error
+}
+
+// NewLogExporter writes ndjson with the whole log per line or csv with the fields as columns.
+func NewLogExporter(format string, fields []string, w io.Writer) (LogExporter, error) {
+	switch format {
+	case "", "ndjson":
+		writer := bufio.NewWriter(w)
+		return &ndjsonExporter{writer: writer, encoder: json.NewEncoder(writer)}, nil
+	case "csv":
+		if len(fields) == 0 {
+			fields = DefaultExportFields
+		}
+		return &csvExporter{writer: csv.NewWriter(w), fields: fields}, nil
+	}
+	return nil, fmt.Errorf("format %q is invalid, use ndjson or csv", format)
+}
+
+type ndjsonExporter struct {
+	writer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func (e *ndjsonExporter) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (e *ndjsonExporter) Write(entry LogsEntry) error {
+	return e.encoder.Encode(entry.Log)
+}
+
+func (e *ndjsonExporter) Flush() error {
+	return e.writer.Flush()
+}
+
+type csvExporter struct {
+	writer        *csv.Writer
+	fields        []string
+	headerWritten bool
+}
+
+func (e *csvExporter) ContentType() string {
+	return "text/csv"
+}
+
+func (e *csvExporter) Write(entry LogsEntry) error {
+	if !e.headerWritten {
+		e.headerWritten = true
+		if err := e.writer.Write(e.fields); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(e.fields))
+	for i, field := range e.fields {
+		record[i] = exportFieldValue(entry, field)
+	}
+	return e.writer.Write(record)
+}
+
+func (e *csvExporter) Flush() error {
+	if !e.headerWritten {
+		e.headerWritten = true
+		if err := e.writer.Write(e.fields); err != nil {
+			return err
+		}
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// exportFieldValue writes values that are not strings, like messages as byte arrays, as JSON.
+func exportFieldValue(entry LogsEntry, field string) string {
+	if field == "time" {
+		return entry.Time.Format(time.RFC3339Nano)
+	}
+	switch value := entry.Log[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	default:
+		valueJson, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(valueJson)
+	}
+}
+
+// ParseExportFields parses a comma separated list of fields.
+func ParseExportFields(value string) []string {
+	fields := make([]string, 0)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,89 @@
+package journal
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLogExporter(t *testing.T) {
+	entries := []LogsEntry{
+		{Time: time.Date(2024, 8, 12, 10, 0, 0, 123000000, time.UTC), Log: map[string]any{"_HOSTNAME": "couchdb-1", "MESSAGE": "started, \"ok\"", "PRIORITY": "6"}},
+		{Time: time.Date(2024, 8, 12, 10, 0, 1, 0, time.UTC), Log: map[string]any{"_HOSTNAME": "couchdb-1", "MESSAGE": []any{float64(104), float64(105)}}},
+	}
+
+	t.Run("should write one log per line as ndjson", func(t *testing.T) {
+		// arrange
+		var output bytes.Buffer
+		exporter, err := NewLogExporter("ndjson", nil, &output)
+		assert.NoError(t, err)
+
+		// act
+		for _, entry := range entries {
+			assert.NoError(t, exporter.Write(entry))
+		}
+		assert.NoError(t, exporter.Flush())
+
+		// assert
+		assert.Equal(t, "application/x-ndjson", exporter.ContentType())
+		assert.Equal(t, `{"MESSAGE":"started, \"ok\"","PRIORITY":"6","_HOSTNAME":"couchdb-1"}
+{"MESSAGE":[104,105],"_HOSTNAME":"couchdb-1"}
+`, output.String())
+	})
+
+	t.Run("should write the selected fields as csv", func(t *testing.T) {
+		// arrange
+		var output bytes.Buffer
+		exporter, err := NewLogExporter("csv", ParseExportFields("time, PRIORITY,MESSAGE,"), &output)
+		assert.NoError(t, err)
+
+		// act
+		for _, entry := range entries {
+			assert.NoError(t, exporter.Write(entry))
+		}
+		assert.NoError(t, exporter.Flush())
+
+		// assert
+		assert.Equal(t, "text/csv", exporter.ContentType())
+		assert.Equal(t, `time,PRIORITY,MESSAGE
+2024-08-12T10:00:00.123Z,6,"started, ""ok"""
+2024-08-12T10:00:01Z,,"[104,105]"
+`, output.String())
+	})
+
+	t.Run("should write the header of an empty csv export", func(t *testing.T) {
+		// arrange
+		var output bytes.Buffer
+		exporter, err := NewLogExporter("csv", nil, &output)
+		assert.NoError(t, err)
+
+		// act
+		assert.NoError(t, exporter.Flush())
+
+		// assert
+		assert.Equal(t, "time,_HOSTNAME,CONTAINER_NAME,SYSLOG_IDENTIFIER,PRIORITY,MESSAGE\n", output.String())
+	})
+
+	t.Run("should reject an unknown format", func(t *testing.T) {
+		// act
+		_, err := NewLogExporter("xml", nil, &bytes.Buffer{})
+
+		// assert
+		assert.Error(t, err)
+	})
+
+	t.Run("should select all logs of the filters without a limit", func(t *testing.T) {
+		// arrange
+		start := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+		data := &LogPageData{StartTime: start, EndTime: start.Add(time.Hour), Hostname: "couchdb-1", Descending: true, Limit: 10}
+
+		// act
+		sql, args, err := logExportSql(data)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT "id", "time", "hash", "log" FROM "logs" WHERE (("time" >= $1) AND ("time" <= $2) AND (log->>'_HOSTNAME' = $3)) ORDER BY "time" DESC, "id" DESC`, sql)
+		assert.Len(t, args, 3)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/doug-martin/goqu/v9"
 	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/gorlug/metrics-backend/logger"
 	"github.com/gorlug/metrics-backend/metrics"
 	"github.com/jackc/pgx/v5"
@@ -18,7 +19,22 @@ import (
 )
 
 type JournalLogService struct {
-	connPool *pgxpool.Pool
+	connPool  *pgxpool.Pool
+	listeners []LogsListener
+	// StripAnsi removes the ANSI escape sequences from the MESSAGE on ingest, the original is
+	// kept as MESSAGE_RAW.
+	StripAnsi bool
+}
+
+// LogsListener is notified about the logs after they were saved. Duplicates are left out.
+// It is called on the ingest path, so it must not block.
+type LogsListener interface {
+	LogsInserted(entries []*LogsEntry)
+}
+
+// AddLogsListener has to be called before the logs are received.
+func (s *JournalLogService) AddLogsListener(listener LogsListener) {
+	s.listeners = append(s.listeners, listener)
 }
 
 func NewJournalLogService(dbUrl string) (*JournalLogService, error) {
@@ -31,15 +47,14 @@ func NewJournalLogService(dbUrl string) (*JournalLogService, error) {
 }
 
 type LogsEntry struct {
-	Id     int
-	Time   time.Time
-	Hash   string
-	Log    map[string]any
-	TimeId int
+	Id   int
+	Time time.Time
+	Hash string
+	Log  map[string]any
 }
 
 func (e *LogsEntry) String() string {
-	return fmt.Sprintf("Id: %d, Time: %v, Hash: %s, Log: %v, TimeId: %v", e.Id, e.Time, e.Hash, e.Log, e.TimeId)
+	return fmt.Sprintf("Id: %d, Time: %v, Hash: %s, Log: %v", e.Id, e.Time, e.Hash, e.Log)
 }
 
 func PrintLogsEntries(entries []*LogsEntry) {
@@ -66,100 +81,165 @@ func (c *LogsEntryCopyFrom) Err() error {
 	return nil
 }
 
-func (s *JournalLogService) SaveJournalLogs(logs string) error {
-	logEntries := ParseJournalLogs(logs)
-	existingHashes, err := s.queryLogsWithTheSameHash(logEntries)
-	log.Printf("existing hashes: %v", existingHashes)
-	if err != nil {
-		return err
-	}
-	filteredLogEntries := filterOutLogEntriesThatHaveTheSameHash(logEntries, existingHashes)
-	if len(filteredLogEntries) == 0 {
-		log.Println("No new logs to save")
-		return nil
-	}
+type SaveLogsResult struct {
+	Inserted   int `json:"inserted"`
+	Duplicates int `json:"duplicates"`
+}
 
-	logEntriesCopyFrom := &LogsEntryCopyFrom{entries: filteredLogEntries}
+func (r *SaveLogsResult) Add(other SaveLogsResult) {
+	r.Inserted += other.Inserted
+	r.Duplicates += other.Duplicates
+}
 
-	copyCount, err := s.connPool.CopyFrom(
-		context.Background(),
-		pgx.Identifier{"logs"},
-		[]string{"time", "hash", "log"},
-		logEntriesCopyFrom,
-	)
-	log.Printf("copied %d logs", copyCount)
-	return err
+func (s *JournalLogService) SaveJournalLogs(logs string) (SaveLogsResult, error) {
+	return s.SaveJournalEntries(ParseJournalLogs(logs))
 }
 
-func (s *JournalLogService) queryLogsWithTheSameHash(logEntries []*LogsEntry) ([]string, error) {
-	hashes := make([]string, len(logEntries))
+// SaveJournalEntries saves the logs of journald, which sends fields that are not valid UTF-8 as
+// byte arrays. They are decoded before the logs are saved.
+func (s *JournalLogService) SaveJournalEntries(logEntries []*LogsEntry) (SaveLogsResult, error) {
 	for _, entry := range logEntries {
-		hashes = append(hashes, entry.Hash)
+		decodeJournalFields(entry.Log)
 	}
-	query := fmt.Sprintf("select hash from logs where hash in ('%s')", strings.Join(hashes, "','"))
-	rows, err := s.connPool.Query(context.Background(), query)
-	if err != nil {
-		return nil, err
+	return s.SaveLogsEntries(logEntries)
+}
+
+// SaveLogsEntries copies the entries into a temporary staging table and inserts them from there.
+// Entries whose hash and time already exist are skipped by the unique index, so concurrent
+// requests with the same logs can't insert duplicates. The fields are normalized before, the hash
+// stays the one of the original log.
+func (s *JournalLogService) SaveLogsEntries(logEntries []*LogsEntry) (SaveLogsResult, error) {
+	result := SaveLogsResult{}
+	if len(logEntries) == 0 {
+		return result, nil
 	}
-	defer rows.Close()
-	logs := make([]string, 0)
-	for rows.Next() {
-		var hashValue string
-		err := rows.Scan(&hashValue)
+	for _, entry := range logEntries {
+		normalizeLogFields(entry.Log, s.StripAnsi)
+	}
+	insertedHashes := make(map[string]bool)
+	err := pgx.BeginFunc(context.Background(), s.connPool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(context.Background(), `
+create temporary table logs_staging (
+    time timestamptz(3) not null,
+    hash text           not null,
+    log  jsonb          not null
+) on commit drop
+`)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		logs = append(logs, hashValue)
+
+		_, err = tx.CopyFrom(
+			context.Background(),
+			pgx.Identifier{"logs_staging"},
+			[]string{"time", "hash", "log"},
+			&LogsEntryCopyFrom{entries: logEntries},
+		)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(context.Background(), `
+insert into logs (time, hash, log)
+select distinct on (hash, time) time, hash, log
+from logs_staging
+on conflict (hash, time) do nothing
+returning hash
+`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var hash string
+			if err := rows.Scan(&hash); err != nil {
+				return err
+			}
+			insertedHashes[hash] = true
+			result.Inserted++
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return SaveLogsResult{}, err
 	}
-	return logs, nil
+	result.Duplicates = len(logEntries) - result.Inserted
+	log.Printf("inserted %d logs, skipped %d duplicates", result.Inserted, result.Duplicates)
+	s.notifyListeners(logEntries, insertedHashes)
+	return result, nil
 }
 
-func filterOutLogEntriesThatHaveTheSameHash(logEntries []*LogsEntry, hashes []string) []*LogsEntry {
-	logsMap := map[string]bool{}
-	for _, hash := range hashes {
-		logsMap[hash] = true
+func (s *JournalLogService) notifyListeners(logEntries []*LogsEntry, insertedHashes map[string]bool) {
+	if len(s.listeners) == 0 || len(insertedHashes) == 0 {
+		return
 	}
-	filteredLogEntries := make([]*LogsEntry, 0)
+	inserted := make([]*LogsEntry, 0, len(insertedHashes))
 	for _, entry := range logEntries {
-		if _, ok := logsMap[entry.Hash]; !ok {
-			filteredLogEntries = append(filteredLogEntries, entry)
+		// an entry that was sent twice in the same batch is only inserted once
+		if insertedHashes[entry.Hash] {
+			inserted = append(inserted, entry)
+			delete(insertedHashes, entry.Hash)
 		}
 	}
-	return filteredLogEntries
+	for _, listener := range s.listeners {
+		listener.LogsInserted(inserted)
+	}
 }
 
 func ParseJournalLogs(logs string) []*LogsEntry {
-	location := GetLocation()
-
 	splitLogs := strings.Split(logs, "\n")
 	logsEntries := make([]*LogsEntry, 0)
 	for _, logLine := range splitLogs {
 		if logLine == "" {
 			continue
 		}
-		logLine = strings.ReplaceAll(logLine, "\n", "\\n")
-		logMap := map[string]any{}
-		err := json.Unmarshal([]byte(logLine), &logMap)
+		entry, err := ParseJournalLogLine(logLine)
 		if err != nil {
-			logger.LogError("Error while unmarshalling log: %v, line: %v", err, logLine)
+			logger.LogError("%v", err)
 			continue
 		}
-		timestampString := logMap["__REALTIME_TIMESTAMP"]
-		timestampInt, err := strconv.ParseInt(fmt.Sprint(timestampString), 10, 64)
-		if err != nil {
-			logger.LogError("Error while converting timestamp to int: %v, logLine: %v", err, logLine)
-			continue
-		}
-		timestamp := time.UnixMicro(timestampInt).In(location)
-		logsEntries = append(logsEntries, &LogsEntry{
-			Time: timestamp,
-			Log:  logMap,
-			Hash: createHash(logLine),
-		})
+		logsEntries = append(logsEntries, entry)
 	}
 	return logsEntries
 }
 
+// ParseJournalLogLine parses one line of journalctl -o json.
+func ParseJournalLogLine(logLine string) (*LogsEntry, error) {
+	logLine = strings.ReplaceAll(logLine, "\n", "\\n")
+	logMap := map[string]any{}
+	err := json.Unmarshal([]byte(logLine), &logMap)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshalling log: %w, line: %v", err, logLine)
+	}
+
+	timestampString := logMap["__REALTIME_TIMESTAMP"]
+	timestampInt, err := strconv.ParseInt(fmt.Sprint(timestampString), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("error while converting timestamp to int: %w, logLine: %v", err, logLine)
+	}
+
+	timestamp := time.UnixMicro(timestampInt).In(GetLocation())
+	return &LogsEntry{
+		Time: timestamp,
+		Log:  logMap,
+		Hash: createHash(logLine),
+	}, nil
+}
+
+// NewLogsEntry creates an entry for a log that was not sent as journald JSON line. The hash
+// is created from the JSON of the log.
+func NewLogsEntry(timestamp time.Time, logMap map[string]any) (*LogsEntry, error) {
+	logJson, err := json.Marshal(logMap)
+	if err != nil {
+		return nil, err
+	}
+	return &LogsEntry{
+		Time: timestamp.In(GetLocation()),
+		Log:  logMap,
+		Hash: createHash(string(logJson)),
+	}, nil
+}
+
 func createHash(input string) string {
 	h := sha256.New()
 	h.Write([]byte(input))
@@ -174,11 +254,21 @@ type LogPageData struct {
 	StartTime       time.Time
 	EndTime         time.Time
 	Limit           int
-	TimeId          int
+	Cursor          *LogCursor
+	Descending      bool
 	AdditionalWhere string
-	Filter          string
+	Query           *Query
 	ContainerName   string
 	Hostname        string
+	// MaxPriority shows only the logs of this priority and the more severe ones, nil shows all
+	MaxPriority *int
+}
+
+// LogPage has a cursor to the next or previous page if there are more logs in that direction.
+type LogPage struct {
+	Entries  []LogsEntry
+	Next     *LogCursor
+	Previous *LogCursor
 }
 
 func setDefaultLogPageData(data *LogPageData) *LogPageData {
@@ -194,8 +284,8 @@ func setDefaultLogPageData(data *LogPageData) *LogPageData {
 	return data
 }
 
-func (s *JournalLogService) GetLogPage(data *LogPageData) ([]LogsEntry, error) {
-	data = setDefaultLogPageData(data)
+// logPageFilter returns the conditions of the time range, container, host, priority and query.
+func logPageFilter(data *LogPageData) exp.ExpressionList {
 	and := goqu.And(
 		goqu.Ex{
 			"time": goqu.Op{"gte": data.StartTime},
@@ -210,32 +300,98 @@ func (s *JournalLogService) GetLogPage(data *LogPageData) ([]LogsEntry, error) {
 	if data.Hostname != "" {
 		and = and.Append(goqu.L("log->>'_HOSTNAME'").Eq(data.Hostname))
 	}
-	if data.Filter != "" {
-		and = and.Append(goqu.L("log->>'MESSAGE'").ILike(fmt.Sprintf("%%%s%%", data.Filter)))
+	if data.MaxPriority != nil {
+		and = and.Append(maxPriorityExpression(*data.MaxPriority))
+	}
+	if data.Query != nil {
+		and = and.Append(data.Query.Expression())
 	}
+	return and
+}
 
-	dialect := goqu.Dialect("postgres")
-	innerFrom := dialect.From("logs").
-		Prepared(true).
-		Select("*", goqu.ROW_NUMBER().
-			Over(goqu.W().OrderBy("time")).
-			As("timeid")).
-		Where(
-			and,
-		).
-		Order(goqu.C("time").Asc())
-
-	sql, args, _ := dialect.From(innerFrom).
+// GetLogPage returns the logs after or before the cursor in the order of time and id. Other
+// than an offset the cursor uses the time index, so later pages are not slower.
+func (s *JournalLogService) GetLogPage(data *LogPageData) (*LogPage, error) {
+	data = setDefaultLogPageData(data)
+	sql, args, err := logPageSql(data)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.connPool.Query(context.Background(), sql, args...)
+	entries, err := rowsToLogsEntryArray(err, rows)
+	if err != nil {
+		return nil, err
+	}
+	return newLogPage(entries, data), nil
+}
+
+func logPageSql(data *LogPageData) (string, []any, error) {
+	where := logPageFilter(data)
+	// the order is reversed to get the logs before the cursor
+	descending := data.Descending
+	if data.Cursor != nil && data.Cursor.Before {
+		descending = !descending
+	}
+	if data.Cursor != nil {
+		// time is compared on its own as well, so that the time index is used
+		operator := "gte"
+		rowOperator := ">"
+		if descending {
+			operator = "lte"
+			rowOperator = "<"
+		}
+		where = where.Append(
+			goqu.Ex{"time": goqu.Op{operator: data.Cursor.Time}},
+			goqu.L(fmt.Sprintf(`("time", "id") %v (?, ?)`, rowOperator), data.Cursor.Time, data.Cursor.Id),
+		)
+	}
+
+	// one more log is selected to know if there is another page
+	return goqu.Dialect("postgres").From("logs").
 		Prepared(true).
-		Where(goqu.Ex{
-			"timeid": goqu.Op{"gt": data.TimeId},
-		}).
-		Limit(uint(data.Limit)).
+		Select("id", "time", "hash", "log").
+		Where(where).
+		Order(logOrder(descending)...).
+		Limit(uint(data.Limit + 1)).
 		ToSQL()
+}
 
-	rows, err := s.connPool.Query(context.Background(), sql, args...)
+func logOrder(descending bool) []exp.OrderedExpression {
+	if descending {
+		return []exp.OrderedExpression{goqu.C("time").Desc(), goqu.C("id").Desc()}
+	}
+	return []exp.OrderedExpression{goqu.C("time").Asc(), goqu.C("id").Asc()}
+}
 
-	return rowsToLogsEntryArray(err, rows)
+func newLogPage(entries []LogsEntry, data *LogPageData) *LogPage {
+	hasMore := len(entries) > data.Limit
+	if hasMore {
+		entries = entries[:data.Limit]
+	}
+	page := &LogPage{Entries: entries}
+	backward := data.Cursor != nil && data.Cursor.Before
+	if backward {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+	if len(entries) == 0 {
+		return page
+	}
+	if backward {
+		page.Next = afterLog(entries[len(entries)-1])
+		if hasMore {
+			page.Previous = beforeLog(entries[0])
+		}
+	} else {
+		if hasMore {
+			page.Next = afterLog(entries[len(entries)-1])
+		}
+		if data.Cursor != nil {
+			page.Previous = beforeLog(entries[0])
+		}
+	}
+	return page
 }
 
 func rowsToLogsEntryArray(err error, rows pgx.Rows) ([]LogsEntry, error) {
@@ -246,11 +402,11 @@ func rowsToLogsEntryArray(err error, rows pgx.Rows) ([]LogsEntry, error) {
 	entries := make([]LogsEntry, 0)
 	for rows.Next() {
 		var entry LogsEntry
-		err := rows.Scan(&entry.Id, &entry.Time, &entry.Hash, &entry.Log, &entry.TimeId)
+		err := rows.Scan(&entry.Id, &entry.Time, &entry.Hash, &entry.Log)
 		if err != nil {
 			return nil, err
 		}
 		entries = append(entries, entry)
 	}
-	return entries, nil
+	return entries, rows.Err()
 }
@@ -0,0 +1,145 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"time"
+)
+
+// HostStorage is the storage used by the logs of a host. Bytes is the size of the log column,
+// without the indexes and the overhead of the rows.
+type HostStorage struct {
+	Host   string
+	Logs   int
+	Bytes  int64
+	Oldest time.Time
+	Newest time.Time
+}
+
+// GetHostStorage reads all logs, so it is meant for the admin view and not for regular use.
+func (s *JournalLogService) GetHostStorage() ([]HostStorage, error) {
+	sql, args, err := hostStorageSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.connPool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	storage := make([]HostStorage, 0)
+	for rows.Next() {
+		var hostStorage HostStorage
+		if err := rows.Scan(&hostStorage.Host, &hostStorage.Logs, &hostStorage.Bytes, &hostStorage.Oldest, &hostStorage.Newest); err != nil {
+			return nil, err
+		}
+		storage = append(storage, hostStorage)
+	}
+	return storage, rows.Err()
+}
+
+func hostStorageSql() (string, []any, error) {
+	return goqu.Dialect("postgres").From("logs").
+		Prepared(true).
+		Select(
+			goqu.L("coalesce(log->>'_HOSTNAME', '')").As("host"),
+			goqu.COUNT("*").As("logs"),
+			goqu.L("sum(pg_column_size(log))::bigint").As("bytes"),
+			goqu.MIN("time").As("oldest"),
+			goqu.MAX("time").As("newest"),
+		).
+		GroupBy(goqu.I("host")).
+		Order(goqu.I("bytes").Desc()).
+		ToSQL()
+}
+
+// GetLogsSize returns the size of the logs hypertable with all chunks and indexes.
+func (s *JournalLogService) GetLogsSize() (int64, error) {
+	var size int64
+	err := s.connPool.QueryRow(context.Background(), "SELECT hypertable_size('logs')").Scan(&size)
+	return size, err
+}
+
+type JournalStorageTable struct {
+	Headers       []string
+	Rows          [][]string
+	TotalSize     string
+	RuleHeaders   []string
+	RetentionRows [][]string
+}
+
+type JournalStorageView struct {
+	journalService  *JournalLogService
+	retentionPolicy *RetentionPolicy
+}
+
+func NewJournalStorageView(journalService *JournalLogService, retentionPolicy *RetentionPolicy) *JournalStorageView {
+	return &JournalStorageView{journalService: journalService, retentionPolicy: retentionPolicy}
+}
+
+// Render shows the storage per host with the retention of its logs, container rules can keep
+// some of them for a different time.
+func (v *JournalStorageView) Render(c echo.Context) error {
+	storage, err := v.journalService.GetHostStorage()
+	if err != nil {
+		log.Println("failed to get the journal storage", err)
+		return err
+	}
+	size, err := v.journalService.GetLogsSize()
+	if err != nil {
+		log.Println("failed to get the journal size", err)
+		return err
+	}
+	return c.Render(http.StatusOK, "journalStorage", CreateJournalStorageTable(storage, size, v.retentionPolicy))
+}
+
+func CreateJournalStorageTable(storage []HostStorage, size int64, retentionPolicy *RetentionPolicy) *JournalStorageTable {
+	table := &JournalStorageTable{
+		Headers:       []string{"Host", "Logs", "Size", "Oldest", "Newest", "Retention"},
+		Rows:          [][]string{},
+		TotalSize:     formatBytes(size),
+		RuleHeaders:   []string{"Logs of", "Retention"},
+		RetentionRows: [][]string{},
+	}
+	for _, hostStorage := range storage {
+		rule := retentionPolicy.RuleFor(hostStorage.Host, "")
+		table.Rows = append(table.Rows, []string{
+			hostStorage.Host,
+			fmt.Sprint(hostStorage.Logs),
+			formatBytes(hostStorage.Bytes),
+			hostStorage.Oldest.In(GetLocation()).Format("02.01.2006 15:04"),
+			hostStorage.Newest.In(GetLocation()).Format("02.01.2006 15:04"),
+			formatRetentionDays(rule.Days),
+		})
+	}
+	for _, rule := range retentionPolicy.Rules {
+		table.RetentionRows = append(table.RetentionRows, []string{rule.String(), formatRetentionDays(rule.Days)})
+	}
+	return table
+}
+
+func formatRetentionDays(days int) string {
+	if days == 1 {
+		return "1 day"
+	}
+	return fmt.Sprintf("%v days", days)
+}
+
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%v B", bytes)
+	}
+	value := float64(bytes)
+	for _, suffix := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		value /= unit
+		if value < unit || suffix == "TiB" {
+			return fmt.Sprintf("%.1f %v", value, suffix)
+		}
+	}
+	return ""
+}
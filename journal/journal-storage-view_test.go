@@ -0,0 +1,30 @@
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestJournalStorageTable(t *testing.T) {
+	t.Run("should show the storage and retention per host", func(t *testing.T) {
+		// arrange
+		policy, err := NewRetentionPolicy([]RetentionRule{{Host: "audit-1", Days: 90}, {Container: "gitlab-runner", Days: 1}})
+		assert.NoError(t, err)
+		oldest := time.Date(2024, 5, 14, 8, 0, 0, 0, time.UTC)
+		newest := time.Date(2024, 8, 12, 8, 0, 0, 0, time.UTC)
+		storage := []HostStorage{
+			{Host: "audit-1", Logs: 1200, Bytes: 5 * 1024 * 1024, Oldest: oldest, Newest: newest},
+			{Host: "ci-1", Logs: 10, Bytes: 900, Oldest: oldest, Newest: newest},
+		}
+
+		// act
+		table := CreateJournalStorageTable(storage, 3*1024*1024*1024, policy)
+
+		// assert
+		assert.Equal(t, "3.0 GiB", table.TotalSize)
+		assert.Equal(t, []string{"audit-1", "1200", "5.0 MiB", "14.05.2024 10:00", "12.08.2024 10:00", "90 days"}, table.Rows[0])
+		assert.Equal(t, []string{"ci-1", "10", "900 B", "14.05.2024 10:00", "12.08.2024 10:00", "7 days"}, table.Rows[1])
+		assert.Equal(t, [][]string{{"host audit-1", "90 days"}, {"container gitlab-runner", "1 day"}, {"all", "7 days"}}, table.RetentionRows)
+	})
+}
@@ -0,0 +1,101 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+)
+
+const DefaultJournalBatchSize = 1000
+const maxJournalLineLength = 1 << 20
+
+var errJournalLineTooLong = errors.New("journal line is too long")
+
+type JournalStreamResult struct {
+	Lines     int `json:"lines"`
+	Invalid   int `json:"invalid"`
+	Forbidden int `json:"forbidden"`
+	SaveLogsResult
+}
+
+// ReadJournalStream reads journalctl -o json output line by line and passes batches of at most
+// batchSize entries to saveBatch while reading, so that only one batch is held in memory.
+// Invalid lines are skipped. If isAllowed is false for an entry it is skipped as well.
+func ReadJournalStream(body io.Reader, batchSize int, isAllowed func(entry *LogsEntry) bool, saveBatch func(entries []*LogsEntry) (SaveLogsResult, error)) (JournalStreamResult, error) {
+	result := JournalStreamResult{}
+	reader := bufio.NewReaderSize(body, 64*1024)
+	batch := make([]*LogsEntry, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		saved, err := saveBatch(batch)
+		if err != nil {
+			return err
+		}
+		result.Add(saved)
+		batch = make([]*LogsEntry, 0, batchSize)
+		return nil
+	}
+
+	for {
+		line, err := readJournalLine(reader)
+		if len(line) > 0 || errors.Is(err, errJournalLineTooLong) {
+			result.Lines++
+		}
+		if errors.Is(err, errJournalLineTooLong) {
+			log.Println("skipping journal line", err)
+			result.Invalid++
+			continue
+		}
+		if len(line) > 0 {
+			entry, parseErr := ParseJournalLogLine(string(line))
+			switch {
+			case parseErr != nil:
+				log.Println("skipping journal line", parseErr)
+				result.Invalid++
+			case !isAllowed(entry):
+				result.Forbidden++
+			default:
+				batch = append(batch, entry)
+			}
+			if len(batch) >= batchSize {
+				if flushErr := flush(); flushErr != nil {
+					return result, flushErr
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return result, flush()
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+}
+
+// readJournalLine returns the next line without the line break. A line that is longer than
+// maxJournalLineLength is discarded and errJournalLineTooLong is returned.
+func readJournalLine(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		fragment, err := reader.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, fragment...)
+			if len(line) > maxJournalLineLength {
+				tooLong = true
+				line = nil
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if tooLong && (err == nil || errors.Is(err, io.EOF)) {
+			return nil, errJournalLineTooLong
+		}
+		return bytes.TrimSpace(line), err
+	}
+}
@@ -0,0 +1,75 @@
+package journal
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestReadJournalStream(t *testing.T) {
+	line := func(host string, timestamp int) string {
+		return fmt.Sprintf(`{"__REALTIME_TIMESTAMP":"%d","_HOSTNAME":"%v","MESSAGE":"hello"}`, timestamp, host)
+	}
+	allowAll := func(*LogsEntry) bool {
+		return true
+	}
+
+	t.Run("should save the entries in batches while reading", func(t *testing.T) {
+		// arrange
+		lines := make([]string, 0)
+		for i := 0; i < 5; i++ {
+			lines = append(lines, line("server-1", 1723552255278199+i))
+		}
+		body := strings.Join(lines, "\n") + "\n"
+		batchSizes := make([]int, 0)
+
+		// act
+		result, err := ReadJournalStream(strings.NewReader(body), 2, allowAll, func(entries []*LogsEntry) (SaveLogsResult, error) {
+			batchSizes = append(batchSizes, len(entries))
+			return SaveLogsResult{Inserted: len(entries) - 1, Duplicates: 1}, nil
+		})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []int{2, 2, 1}, batchSizes)
+		assert.Equal(t, JournalStreamResult{Lines: 5, SaveLogsResult: SaveLogsResult{Inserted: 2, Duplicates: 3}}, result)
+	})
+
+	t.Run("should skip invalid, too long and forbidden lines", func(t *testing.T) {
+		// arrange
+		body := strings.Join([]string{
+			line("server-1", 1723552255278199),
+			"not json",
+			`{"MESSAGE":"no timestamp"}`,
+			`{"MESSAGE":"` + strings.Repeat("a", maxJournalLineLength) + `"}`,
+			"",
+			line("server-2", 1723552255278199),
+			line("server-1", 1723552255278200),
+		}, "\r\n")
+		saved := make([]*LogsEntry, 0)
+
+		// act
+		result, err := ReadJournalStream(strings.NewReader(body), 10, func(entry *LogsEntry) bool {
+			return entry.Log["_HOSTNAME"] == "server-1"
+		}, func(entries []*LogsEntry) (SaveLogsResult, error) {
+			saved = append(saved, entries...)
+			return SaveLogsResult{Inserted: len(entries)}, nil
+		})
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, JournalStreamResult{Lines: 6, Invalid: 3, Forbidden: 1, SaveLogsResult: SaveLogsResult{Inserted: 2}}, result)
+		assert.Equal(t, 2, len(saved))
+		expected, err := ParseJournalLogLine(line("server-1", 1723552255278199))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, saved[0])
+	})
+
+	t.Run("should stop if saving fails", func(t *testing.T) {
+		_, err := ReadJournalStream(strings.NewReader(line("server-1", 1723552255278199)), 10, allowAll, func([]*LogsEntry) (SaveLogsResult, error) {
+			return SaveLogsResult{}, fmt.Errorf("database is down")
+		})
+		assert.Error(t, err)
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/labstack/echo/v4"
 	"log"
 	"net/http"
+	"net/url"
+	"regexp"
 	"time"
 )
 
@@ -22,20 +24,61 @@ func formatDateRangeInputTimeStamp(time time.Time) string {
 type PaginationButton struct {
 	Enabled bool
 	Url     string
-	Page    int
+	Cursor  string
 	Label   string
 	Name    string
 }
 
+func newPaginationButton(url string, cursor *LogCursor, label string, name string) *PaginationButton {
+	button := &PaginationButton{Enabled: cursor != nil, Url: url, Label: label, Name: name}
+	if cursor != nil {
+		button.Cursor = cursor.Encode()
+	}
+	return button
+}
+
 type TextInput struct {
 	Label string
 	Name  string
 	Value string
 }
 
+type CheckboxInput struct {
+	Label   string
+	Name    string
+	Value   string
+	Checked bool
+}
+
+type SelectInput struct {
+	Label   string
+	Name    string
+	Options []SelectOption
+}
+
+type SelectOption struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+// JournalCell is the content of a table cell, the matches of the query are highlighted.
+type JournalCell []TextPart
+
+func textCell(text string) JournalCell {
+	return JournalCell{{Text: text}}
+}
+
+// JournalRow is colored by the priority of the log.
+type JournalRow struct {
+	Cells []JournalCell
+	Class string
+	Color string
+}
+
 type JournalTable struct {
 	Headers        []string
-	Rows           [][]string
+	Rows           []JournalRow
 	NextUrl        string
 	StartInput     *DateRangeInput
 	EndInput       *DateRangeInput
@@ -45,8 +88,23 @@ type JournalTable struct {
 	Container      *TextInput
 	Host           *TextInput
 	Filter         *TextInput
+	Descending     *CheckboxInput
+	MaxPriority    *SelectInput
+	ErrorsOnly     *CheckboxInput
+	QueryError     string
+	LiveTail       *LiveTail
+	ExportUrl      string
+	Histogram      *LogHistogram
 }
 
+// LiveTail is set if the new logs are streamed to the table instead of showing a page.
+type LiveTail struct {
+	Url     string
+	MaxRows int
+}
+
+const maxLiveTailRows = 500
+
 type JournalView struct {
 	journalService *JournalLogService
 }
@@ -56,56 +114,63 @@ func NewJournalView(journalService *JournalLogService) *JournalView {
 }
 
 type JournalRenderData struct {
-	Start     time.Time
-	End       time.Time
-	Page      int
-	PageSize  int
-	Container string
-	Host      string
-	Filter    string
+	Start       time.Time
+	End         time.Time
+	Cursor      string
+	PageSize    int
+	Container   string
+	Host        string
+	Filter      string
+	Descending  bool
+	Live        bool
+	MaxPriority *int
+	ErrorsOnly  bool
 }
 
-func (j *JournalView) CreateJournalTable(data *JournalRenderData) (*JournalTable, error) {
-	println(fmt.Sprintf("CreateJournalTable start: %v, end: %v, page: %v, pageSize: %v, container: %v, host: %v", data.Start, data.End, data.Page, data.PageSize, data.Container, data.Host))
-
-	location := GetLocation()
+// effectiveMaxPriority limits the selected priority to the errors if errors only is set.
+func (d *JournalRenderData) effectiveMaxPriority() *int {
+	if !d.ErrorsOnly || (d.MaxPriority != nil && *d.MaxPriority < ErrorPriority) {
+		return d.MaxPriority
+	}
+	errorPriority := ErrorPriority
+	return &errorPriority
+}
 
+func (j *JournalView) CreateJournalTable(data *JournalRenderData) (*JournalTable, error) {
+	query, queryErr := ParseQuery(data.Filter)
+	cursor, err := DecodeLogCursor(data.Cursor)
+	if err != nil {
+		// starts at the first page
+		log.Printf("ignoring journal cursor: %v", err)
+	}
 	pageData := &LogPageData{
 		StartTime:     data.Start,
 		EndTime:       data.End,
 		Limit:         data.PageSize,
-		TimeId:        data.PageSize * (data.Page - 1),
+		Cursor:        cursor,
+		Descending:    data.Descending,
 		ContainerName: data.Container,
 		Hostname:      data.Host,
-		Filter:        data.Filter,
-	}
-	var journalLogs []LogsEntry
-	var err error
-
-	journalLogs, err = j.journalService.GetLogPage(pageData)
-	if err != nil {
-		log.Printf("failed to get journal logs: %v", err)
-		return nil, err
-	}
-
-	previousPage := 1
-	if data.Page > 1 {
-		previousPage = data.Page - 1
+		Query:         query,
+		MaxPriority:   data.effectiveMaxPriority(),
 	}
-
-	nextPage := data.Page
-	if len(journalLogs) == data.PageSize {
-		nextPage = data.Page + 1
+	page := &LogPage{Entries: make([]LogsEntry, 0)}
+	if queryErr == nil && !data.Live {
+		page, err = j.journalService.GetLogPage(pageData)
+		if err != nil {
+			log.Printf("failed to get journal logs: %v", err)
+			return nil, err
+		}
 	}
 
 	const journalUrl = "/journal"
-	headers := []string{"Time", "Log"}
+	headers := []string{"Time", "Severity", "Log"}
 	if data.Container != "" {
 		headers = append(headers, "Host")
 	}
 	table := &JournalTable{
 		Headers: headers,
-		Rows:    [][]string{},
+		Rows:    []JournalRow{},
 		NextUrl: journalUrl,
 		StartInput: &DateRangeInput{
 			Timestamp: formatDateRangeInputTimeStamp(data.Start),
@@ -117,20 +182,8 @@ func (j *JournalView) CreateJournalTable(data *JournalRenderData) (*JournalTable
 			Name:      "end",
 			Label:     "End",
 		},
-		NextButton: &PaginationButton{
-			Enabled: nextPage != data.Page,
-			Url:     journalUrl,
-			Page:    nextPage,
-			Label:   "Next",
-			Name:    "next",
-		},
-		PreviousButton: &PaginationButton{
-			Enabled: data.Page != 1,
-			Url:     journalUrl,
-			Page:    previousPage,
-			Label:   "Previous",
-			Name:    "previous",
-		},
+		NextButton:     newPaginationButton(journalUrl, page.Next, "Next", "next"),
+		PreviousButton: newPaginationButton(journalUrl, page.Previous, "Previous", "previous"),
 		PageSize: &TextInput{
 			Label: "Page Size",
 			Name:  "pageSize",
@@ -147,35 +200,163 @@ func (j *JournalView) CreateJournalTable(data *JournalRenderData) (*JournalTable
 			Value: data.Host,
 		},
 		Filter: &TextInput{
-			Label: "Container message filter",
+			Label: "Query, for example PRIORITY<=3 AND _SYSTEMD_UNIT:nginx* AND NOT MESSAGE~\"health\"",
 			Name:  "filter",
 			Value: data.Filter,
 		},
+		Descending: &CheckboxInput{
+			Label:   "Newest first",
+			Name:    "order",
+			Value:   "desc",
+			Checked: data.Descending,
+		},
+		MaxPriority: createMaxPrioritySelect(data.MaxPriority),
+		ErrorsOnly: &CheckboxInput{
+			Label:   "Errors only",
+			Name:    "errors",
+			Value:   "on",
+			Checked: data.ErrorsOnly,
+		},
+	}
+	if queryErr != nil {
+		table.QueryError = fmt.Sprintf("invalid query: %v", queryErr)
+	} else if data.Live {
+		tailQuery := url.Values{}
+		tailQuery.Set("container", data.Container)
+		tailQuery.Set("host", data.Host)
+		tailQuery.Set("filter", data.Filter)
+		setMaxPriorityQuery(tailQuery, data.effectiveMaxPriority())
+		table.LiveTail = &LiveTail{Url: journalUrl + "/tail?" + tailQuery.Encode(), MaxRows: maxLiveTailRows}
+	} else {
+		table.ExportUrl = createExportUrl(data)
+		table.Histogram = j.createHistogram(pageData, data)
 	}
 	log.Printf("next url: %v", table.NextUrl)
 
-	for _, logEntry := range journalLogs {
-		var logValue string
-		if data.Container != "" {
-			logValue = fmt.Sprint(logEntry.Log["MESSAGE"])
-		} else {
-			jsonObject, err := json.Marshal(logEntry.Log)
-			if err != nil {
-				log.Printf("failed to marshal log entry: %v", err)
-				continue
-			}
-			logValue = fmt.Sprint(string(jsonObject))
-		}
-		rowContent := []string{logEntry.Time.In(location).Format("15:04:05.000 02.01.2006"), logValue}
-		if data.Container != "" {
-			rowContent = append(rowContent, fmt.Sprint(logEntry.Log["_HOSTNAME"]))
+	var highlightPatterns []*regexp.Regexp
+	if query != nil {
+		highlightPatterns = query.MessagePatterns()
+	}
+
+	for _, logEntry := range page.Entries {
+		row, err := CreateJournalRow(&logEntry, data.Container, highlightPatterns)
+		if err != nil {
+			log.Printf("failed to marshal log entry: %v", err)
+			continue
 		}
-		table.Rows = append(table.Rows, rowContent)
+		table.Rows = append(table.Rows, row)
 
 	}
 	return table, nil
 }
 
+// createExportUrl exports the logs of the whole time range with the filters of the view, the
+// format is added by the view.
+func createExportUrl(data *JournalRenderData) string {
+	exportQuery := url.Values{}
+	exportQuery.Set("start", data.Start.Format(time.RFC3339))
+	exportQuery.Set("end", data.End.Format(time.RFC3339))
+	exportQuery.Set("container", data.Container)
+	exportQuery.Set("host", data.Host)
+	exportQuery.Set("filter", data.Filter)
+	setMaxPriorityQuery(exportQuery, data.effectiveMaxPriority())
+	if data.Descending {
+		exportQuery.Set("order", "desc")
+	}
+	return "/api/v1/journal/export?" + exportQuery.Encode()
+}
+
+// createHistogram returns nil if the counts could not be loaded, the logs are shown anyway.
+func (j *JournalView) createHistogram(pageData *LogPageData, data *JournalRenderData) *LogHistogram {
+	bucketSize := HistogramBucketSize(data.Start, data.End)
+	counts, err := j.journalService.GetLogCounts(pageData, bucketSize)
+	if err != nil {
+		log.Println("failed to get journal log counts", err)
+		return nil
+	}
+	return NewLogHistogram(counts, data.Start, data.End, bucketSize, func(bucketStart time.Time, bucketEnd time.Time) string {
+		return createBucketUrl(data, bucketStart, bucketEnd)
+	})
+}
+
+// createBucketUrl shows the logs of the bucket with the filters of the view.
+func createBucketUrl(data *JournalRenderData, bucketStart time.Time, bucketEnd time.Time) string {
+	location := data.Start.Location()
+	bucketQuery := url.Values{}
+	bucketQuery.Set("start", formatDateRangeInputTimeStamp(bucketStart.In(location)))
+	bucketQuery.Set("end", formatDateRangeInputTimeStamp(bucketEnd.In(location)))
+	bucketQuery.Set("timezone", location.String())
+	bucketQuery.Set("pageSize", fmt.Sprint(data.PageSize))
+	bucketQuery.Set("container", data.Container)
+	bucketQuery.Set("host", data.Host)
+	bucketQuery.Set("filter", data.Filter)
+	setMaxPriorityQuery(bucketQuery, data.MaxPriority)
+	if data.ErrorsOnly {
+		bucketQuery.Set("errors", "on")
+	}
+	if data.Descending {
+		bucketQuery.Set("order", "desc")
+	}
+	return "/journal?" + bucketQuery.Encode()
+}
+
+func setMaxPriorityQuery(query url.Values, maxPriority *int) {
+	if maxPriority != nil {
+		query.Set("priority", fmt.Sprint(*maxPriority))
+	}
+}
+
+// createMaxPrioritySelect offers a priority and the more severe ones, for example "warning and
+// worse".
+func createMaxPrioritySelect(maxPriority *int) *SelectInput {
+	input := &SelectInput{
+		Label:   "Severity",
+		Name:    "priority",
+		Options: []SelectOption{{Value: "", Label: "All", Selected: maxPriority == nil}},
+	}
+	for i, priority := range logPriorities[:len(logPriorities)-1] {
+		label := priority.label
+		if i > 0 {
+			label += " and worse"
+		}
+		input.Options = append(input.Options, SelectOption{
+			Value:    priority.value,
+			Label:    label,
+			Selected: maxPriority != nil && *maxPriority == i,
+		})
+	}
+	return input
+}
+
+// CreateJournalRow shows only the message and the host if the logs are filtered by a container,
+// otherwise the whole log. It is also used for the rows of the live tail.
+func CreateJournalRow(logEntry *LogsEntry, container string, highlightPatterns []*regexp.Regexp) (JournalRow, error) {
+	var logValue string
+	if container != "" {
+		logValue = logMessage(logEntry)
+	} else {
+		jsonObject, err := json.Marshal(logEntry.Log)
+		if err != nil {
+			return JournalRow{}, err
+		}
+		logValue = string(jsonObject)
+	}
+	priority := getLogPriority(logField(logEntry, priorityField))
+	row := JournalRow{
+		Cells: []JournalCell{
+			textCell(logEntry.Time.In(GetLocation()).Format("15:04:05.000 02.01.2006")),
+			textCell(priority.label),
+			HighlightText(logValue, highlightPatterns),
+		},
+		Class: priority.rowClass,
+		Color: priority.color,
+	}
+	if container != "" {
+		row.Cells = append(row.Cells, textCell(fmt.Sprint(logEntry.Log["_HOSTNAME"])))
+	}
+	return row, nil
+}
+
 func (j *JournalView) Render(c echo.Context, data *JournalRenderData) error {
 	table, err := j.CreateJournalTable(data)
 	if err != nil {
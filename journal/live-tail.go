@@ -0,0 +1,78 @@
+package journal
+
+import (
+	"github.com/gorlug/metrics-backend/stats"
+	"sync"
+)
+
+var liveTailDroppedTotal = stats.NewCounter("metrics_backend_live_tail_dropped_total", "Number of logs that were not sent to a live tail client, because the client was too slow.")
+
+const liveTailBufferSize = 256
+
+// LogFilter is the filter of the journal view applied to single logs.
+type LogFilter struct {
+	Container   string
+	Host        string
+	MaxPriority *int
+	Query       *Query
+}
+
+func (f LogFilter) Matches(entry *LogsEntry) bool {
+	if f.Container != "" && logField(entry, "CONTAINER_NAME") != f.Container {
+		return false
+	}
+	if f.Host != "" && logField(entry, "_HOSTNAME") != f.Host {
+		return false
+	}
+	if !priorityMatches(entry, f.MaxPriority) {
+		return false
+	}
+	return f.Query == nil || f.Query.Matches(entry.Log)
+}
+
+type LiveTailSubscription struct {
+	Entries chan *LogsEntry
+	Filter  LogFilter
+}
+
+// LogBroadcaster passes the inserted logs to the live tail subscriptions whose filter they
+// match. The ingestion doesn't wait for slow subscribers, their logs are dropped instead.
+type LogBroadcaster struct {
+	subscriptions map[*LiveTailSubscription]bool
+	mutex         sync.RWMutex
+}
+
+func NewLogBroadcaster() *LogBroadcaster {
+	return &LogBroadcaster{subscriptions: make(map[*LiveTailSubscription]bool)}
+}
+
+func (b *LogBroadcaster) Subscribe(filter LogFilter) *LiveTailSubscription {
+	subscription := &LiveTailSubscription{Entries: make(chan *LogsEntry, liveTailBufferSize), Filter: filter}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.subscriptions[subscription] = true
+	return subscription
+}
+
+func (b *LogBroadcaster) Unsubscribe(subscription *LiveTailSubscription) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.subscriptions, subscription)
+}
+
+func (b *LogBroadcaster) LogsInserted(entries []*LogsEntry) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for subscription := range b.subscriptions {
+		for _, entry := range entries {
+			if !subscription.Filter.Matches(entry) {
+				continue
+			}
+			select {
+			case subscription.Entries <- entry:
+			default:
+				liveTailDroppedTotal.Inc()
+			}
+		}
+	}
+}
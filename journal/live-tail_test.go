@@ -0,0 +1,58 @@
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLogBroadcaster(t *testing.T) {
+	nginx := newTestLogsEntry(map[string]any{"_HOSTNAME": "web-1", "CONTAINER_NAME": "nginx", "MESSAGE": "GET /health"})
+	runner := newTestLogsEntry(map[string]any{"_HOSTNAME": "ci-1", "CONTAINER_NAME": "gitlab-runner", "MESSAGE": "job failed", "PRIORITY": "3"})
+
+	t.Run("should pass the logs to the subscriptions whose filter they match", func(t *testing.T) {
+		// arrange
+		broadcaster := NewLogBroadcaster()
+		query, err := ParseQuery("PRIORITY<=3")
+		assert.NoError(t, err)
+		errors := broadcaster.Subscribe(LogFilter{Query: query})
+		web := broadcaster.Subscribe(LogFilter{Host: "web-1", Container: "nginx"})
+
+		// act
+		broadcaster.LogsInserted([]*LogsEntry{nginx, runner})
+
+		// assert
+		assert.Len(t, errors.Entries, 1)
+		assert.Equal(t, runner, <-errors.Entries)
+		assert.Len(t, web.Entries, 1)
+		assert.Equal(t, nginx, <-web.Entries)
+	})
+
+	t.Run("should not pass logs after unsubscribing", func(t *testing.T) {
+		// arrange
+		broadcaster := NewLogBroadcaster()
+		subscription := broadcaster.Subscribe(LogFilter{})
+		broadcaster.Unsubscribe(subscription)
+
+		// act
+		broadcaster.LogsInserted([]*LogsEntry{nginx})
+
+		// assert
+		assert.Empty(t, subscription.Entries)
+	})
+
+	t.Run("should drop the logs of a slow subscription instead of blocking", func(t *testing.T) {
+		// arrange
+		broadcaster := NewLogBroadcaster()
+		subscription := broadcaster.Subscribe(LogFilter{})
+		entries := make([]*LogsEntry, liveTailBufferSize+10)
+		for i := range entries {
+			entries[i] = nginx
+		}
+
+		// act
+		broadcaster.LogsInserted(entries)
+
+		// assert
+		assert.Len(t, subscription.Entries, liveTailBufferSize)
+	})
+}
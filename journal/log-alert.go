@@ -0,0 +1,314 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorlug/metrics-backend/metrics"
+	"github.com/gorlug/metrics-backend/stats"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logAlertBatchesDroppedTotal = stats.NewCounter("metrics_backend_log_alert_batches_dropped_total", "Number of inserted log batches that were not checked for log alerts, because the queue was full.")
+
+const (
+	defaultLogAlertWindowMinutes = 5
+	maxLogAlertLines             = 5
+	maxLogAlertLineLength        = 200
+	logAlertQueueSize            = 100
+	logAlertCheckInterval        = 30 * time.Second
+)
+
+// LogAlertRule alerts when at least Threshold logs matched within the window. Query filters the
+// logs with the query language of the journal view and Regex is applied to the MESSAGE. Host
+// and Container limit the rule to the logs of a host or container, empty matches all. The
+// matches are counted per host and container by the time of the logs.
+type LogAlertRule struct {
+	Name          string `json:"name"`
+	Query         string `json:"query"`
+	Regex         string `json:"regex"`
+	Threshold     int    `json:"threshold"`
+	WindowMinutes int    `json:"windowMinutes"`
+	Host          string `json:"host"`
+	Container     string `json:"container"`
+
+	query *Query
+	regex *regexp.Regexp
+}
+
+func (r *LogAlertRule) compile() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.Query == "" && r.Regex == "" {
+		return fmt.Errorf("rule %v: query or regex is required", r.Name)
+	}
+	if r.Threshold < 0 || r.WindowMinutes < 0 {
+		return fmt.Errorf("rule %v: threshold and windowMinutes must not be negative", r.Name)
+	}
+	if r.Threshold == 0 {
+		r.Threshold = 1
+	}
+	if r.WindowMinutes == 0 {
+		r.WindowMinutes = defaultLogAlertWindowMinutes
+	}
+	query, err := ParseQuery(r.Query)
+	if err != nil {
+		return fmt.Errorf("rule %v: invalid query: %w", r.Name, err)
+	}
+	r.query = query
+	if r.Regex != "" {
+		r.regex, err = regexp.Compile(r.Regex)
+		if err != nil {
+			return fmt.Errorf("rule %v: invalid regex: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *LogAlertRule) matches(entry *LogsEntry) bool {
+	if r.Host != "" && logField(entry, "_HOSTNAME") != r.Host {
+		return false
+	}
+	if r.Container != "" && logField(entry, "CONTAINER_NAME") != r.Container {
+		return false
+	}
+	if r.query != nil && !r.query.Matches(entry.Log) {
+		return false
+	}
+	return r.regex == nil || r.regex.MatchString(logMessage(entry))
+}
+
+func (r *LogAlertRule) window() time.Duration {
+	return time.Duration(r.WindowMinutes) * time.Minute
+}
+
+// LoadLogAlertRules reads the rules from a JSON file. Returns nil if no file is configured.
+func LoadLogAlertRules(file string) ([]*LogAlertRule, error) {
+	if file == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*LogAlertRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse log alert rules: %w", err)
+	}
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, err
+		}
+		// the states of the rules are kept by name
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %v: the name is used by another rule", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return rules, nil
+}
+
+// logAlertState holds the matches of a rule for one host and container. They are counted per
+// minute, so that a flood of matching logs doesn't use up the memory.
+type logAlertState struct {
+	rule      *LogAlertRule
+	host      string
+	container string
+	// matches are sorted by minute
+	matches  []minuteMatches
+	lines    []string
+	alerting bool
+}
+
+type minuteMatches struct {
+	minute time.Time
+	count  int
+}
+
+// LogAlerter checks the inserted logs against the rules in its own goroutine, so that the
+// ingestion doesn't wait for it. Alerts are sent through the Alerter.
+type LogAlerter struct {
+	rules   []*LogAlertRule
+	alerter metrics.Alerter
+	queue   chan []*LogsEntry
+	states  map[string]*logAlertState
+	mutex   sync.Mutex
+}
+
+func NewLogAlerter(rules []*LogAlertRule, alerter metrics.Alerter) *LogAlerter {
+	return &LogAlerter{
+		rules:   rules,
+		alerter: alerter,
+		queue:   make(chan []*LogsEntry, logAlertQueueSize),
+		states:  make(map[string]*logAlertState),
+	}
+}
+
+func (a *LogAlerter) LogsInserted(entries []*LogsEntry) {
+	select {
+	case a.queue <- entries:
+	default:
+		log.Println("failed to queue logs for the log alerts, the queue is full")
+		logAlertBatchesDroppedTotal.Inc()
+	}
+}
+
+// Start checks the queued logs and periodically sends ok again for the rules whose window
+// passed without enough matches.
+func (a *LogAlerter) Start() {
+	go func() {
+		ticker := time.NewTicker(logAlertCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case entries := <-a.queue:
+				a.checkLogs(entries, time.Now())
+			case now := <-ticker.C:
+				a.checkWindows(now)
+			}
+		}
+	}()
+}
+
+func (a *LogAlerter) checkLogs(entries []*LogsEntry, now time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for _, entry := range entries {
+		for _, rule := range a.rules {
+			// the logs are counted by their time, late logs don't count anymore
+			if entry.Time.Before(now.Add(-rule.window())) || !rule.matches(entry) {
+				continue
+			}
+			state := a.getState(rule, entry)
+			state.addMatch(entry.Time.Truncate(time.Minute))
+			state.lines = append(state.lines, formatLogAlertLine(entry))
+			if len(state.lines) > maxLogAlertLines {
+				state.lines = state.lines[len(state.lines)-maxLogAlertLines:]
+			}
+		}
+	}
+	for _, state := range a.states {
+		state.prune(now)
+		if !state.alerting && state.count() >= state.rule.Threshold {
+			state.alerting = true
+			a.send(a.alerter.NewAlert, state, metrics.Alert)
+		}
+	}
+}
+
+func (a *LogAlerter) checkWindows(now time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for key, state := range a.states {
+		state.prune(now)
+		if state.alerting && state.count() < state.rule.Threshold {
+			state.alerting = false
+			a.send(a.alerter.AlertOkAgain, state, metrics.OK)
+		}
+		if !state.alerting && len(state.matches) == 0 {
+			delete(a.states, key)
+		}
+	}
+}
+
+func (a *LogAlerter) getState(rule *LogAlertRule, entry *LogsEntry) *logAlertState {
+	host := logField(entry, "_HOSTNAME")
+	container := logField(entry, "CONTAINER_NAME")
+	key := strings.Join([]string{rule.Name, host, container}, "\xff")
+	state, exists := a.states[key]
+	if !exists {
+		state = &logAlertState{rule: rule, host: host, container: container}
+		a.states[key] = state
+	}
+	return state
+}
+
+func (a *LogAlerter) send(send func(metric metrics.Metric) error, state *logAlertState, metricState metrics.MetricState) {
+	err := send(state.toMetric(metricState))
+	if err != nil {
+		log.Println("failed to send log alert", err)
+	}
+}
+
+func (s *logAlertState) addMatch(minute time.Time) {
+	i := len(s.matches)
+	for i > 0 && s.matches[i-1].minute.After(minute) {
+		i--
+	}
+	if i > 0 && s.matches[i-1].minute.Equal(minute) {
+		s.matches[i-1].count++
+		return
+	}
+	s.matches = append(s.matches, minuteMatches{})
+	copy(s.matches[i+1:], s.matches[i:])
+	s.matches[i] = minuteMatches{minute: minute, count: 1}
+}
+
+func (s *logAlertState) count() int {
+	count := 0
+	for _, matches := range s.matches {
+		count += matches.count
+	}
+	return count
+}
+
+// prune removes the minutes that ended before the window.
+func (s *logAlertState) prune(now time.Time) {
+	windowStart := now.Add(-s.rule.window())
+	first := 0
+	for first < len(s.matches) && !s.matches[first].minute.Add(time.Minute).After(windowStart) {
+		first++
+	}
+	s.matches = s.matches[first:]
+}
+
+// toMetric is used for the alert message, the value contains the last matching log lines.
+func (s *logAlertState) toMetric(state metrics.MetricState) metrics.Metric {
+	name := "Log alert " + s.rule.Name
+	if s.container != "" {
+		name = fmt.Sprintf("%v (%v)", name, s.container)
+	}
+	value := ""
+	if state == metrics.Alert {
+		value = fmt.Sprintf("%v matches in %vm\n%v", s.count(), s.rule.WindowMinutes, strings.Join(s.lines, "\n"))
+	}
+	return metrics.NewMetricBuilder().
+		WithHost(s.host).
+		WithName(name).
+		WithType(metrics.Ping).
+		WithState(state).
+		WithValue(value).
+		Build()
+}
+
+func formatLogAlertLine(entry *LogsEntry) string {
+	line := fmt.Sprintf("%v %v", entry.Time.In(GetLocation()).Format("15:04:05"), logMessage(entry))
+	if runes := []rune(line); len(runes) > maxLogAlertLineLength {
+		line = string(runes[:maxLogAlertLineLength]) + "…"
+	}
+	return line
+}
+
+// logMessage also decodes the byte array messages saved before they were decoded on ingest.
+func logMessage(entry *LogsEntry) string {
+	switch message := entry.Log[messageField].(type) {
+	case string:
+		return message
+	case []any:
+		if text, ok := decodeByteArray(message); ok {
+			return text
+		}
+	}
+	return fmt.Sprint(entry.Log[messageField])
+}
+
+func logField(entry *LogsEntry, field string) string {
+	value, _ := entry.Log[field].(string)
+	return value
+}
@@ -0,0 +1,186 @@
+package journal
+
+import (
+	"github.com/gorlug/metrics-backend/metrics"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type recordingAlerter struct {
+	alerts  []metrics.Metric
+	okAgain []metrics.Metric
+}
+
+func (r *recordingAlerter) NewAlert(metric metrics.Metric) error {
+	r.alerts = append(r.alerts, metric)
+	return nil
+}
+
+func (r *recordingAlerter) AlertOkAgain(metric metrics.Metric) error {
+	r.okAgain = append(r.okAgain, metric)
+	return nil
+}
+
+func newTestLogsEntry(logMap map[string]any) *LogsEntry {
+	return &LogsEntry{Time: time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC), Log: logMap}
+}
+
+func TestLogAlerter(t *testing.T) {
+	now := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+	outOfMemory := newTestLogsEntry(map[string]any{"_HOSTNAME": "couchdb-1", "MESSAGE": "Out of memory: Killed process 123", "PRIORITY": "3"})
+	critical := newTestLogsEntry(map[string]any{"_HOSTNAME": "couchdb-1", "CONTAINER_NAME": "gitlab-runner", "MESSAGE": "panic", "PRIORITY": "2"})
+	info := newTestLogsEntry(map[string]any{"_HOSTNAME": "couchdb-1", "CONTAINER_NAME": "gitlab-runner", "MESSAGE": "job started", "PRIORITY": "6"})
+
+	newLogAlerter := func(t *testing.T, rules ...*LogAlertRule) (*LogAlerter, *recordingAlerter) {
+		for _, rule := range rules {
+			assert.NoError(t, rule.compile())
+		}
+		alerter := &recordingAlerter{}
+		return NewLogAlerter(rules, alerter), alerter
+	}
+
+	t.Run("should alert once the threshold is reached within the window", func(t *testing.T) {
+		// arrange
+		logAlerter, alerter := newLogAlerter(t, &LogAlertRule{Name: "oom", Regex: "Out of memory", Threshold: 2})
+
+		// act
+		logAlerter.checkLogs([]*LogsEntry{outOfMemory, info}, now)
+		alertsAfterFirst := len(alerter.alerts)
+		logAlerter.checkLogs([]*LogsEntry{outOfMemory}, now.Add(time.Minute))
+		logAlerter.checkLogs([]*LogsEntry{outOfMemory}, now.Add(2*time.Minute))
+
+		// assert
+		assert.Equal(t, 0, alertsAfterFirst)
+		assert.Len(t, alerter.alerts, 1)
+		values := alerter.alerts[0].GetMetricValues()
+		assert.Equal(t, "couchdb-1", values.Host)
+		assert.Equal(t, "Log alert oom", values.Name)
+		assert.Contains(t, values.Value, "2 matches in 5m")
+		assert.Contains(t, values.Value, "Out of memory: Killed process 123")
+	})
+
+	t.Run("should not count matches outside of the window", func(t *testing.T) {
+		// arrange
+		logAlerter, alerter := newLogAlerter(t, &LogAlertRule{Name: "oom", Regex: "Out of memory", Threshold: 2, WindowMinutes: 5})
+
+		// act
+		logAlerter.checkLogs([]*LogsEntry{outOfMemory}, now)
+		logAlerter.checkLogs([]*LogsEntry{outOfMemory}, now.Add(6*time.Minute))
+
+		// assert
+		assert.Empty(t, alerter.alerts)
+	})
+
+	t.Run("should count the logs by their time and ignore late logs", func(t *testing.T) {
+		// arrange
+		logAlerter, alerter := newLogAlerter(t, &LogAlertRule{Name: "oom", Regex: "Out of memory", Threshold: 2, WindowMinutes: 5})
+		late := &LogsEntry{Time: now.Add(-10 * time.Minute), Log: outOfMemory.Log}
+
+		// act
+		logAlerter.checkLogs([]*LogsEntry{late, late, outOfMemory}, now)
+
+		// assert
+		assert.Empty(t, alerter.alerts)
+	})
+
+	t.Run("should keep one count per minute", func(t *testing.T) {
+		// arrange
+		logAlerter, alerter := newLogAlerter(t, &LogAlertRule{Name: "oom", Regex: "Out of memory", Threshold: 960})
+		entries := make([]*LogsEntry, 0)
+		for i := 0; i < 960; i++ {
+			entries = append(entries, &LogsEntry{Time: now.Add(time.Duration(i%120) * time.Second), Log: outOfMemory.Log})
+		}
+
+		// act
+		logAlerter.checkLogs(entries, now.Add(2*time.Minute))
+
+		// assert
+		assert.Len(t, alerter.alerts, 1)
+		assert.Contains(t, alerter.alerts[0].GetMetricValues().Value, "960 matches in 5m")
+		for _, state := range logAlerter.states {
+			assert.Equal(t, []minuteMatches{{minute: now, count: 480}, {minute: now.Add(time.Minute), count: 480}}, state.matches)
+		}
+	})
+
+	t.Run("should send ok again after the window passed", func(t *testing.T) {
+		// arrange
+		logAlerter, alerter := newLogAlerter(t, &LogAlertRule{Name: "critical", Query: "PRIORITY<=2", Container: "gitlab-runner"})
+
+		// act
+		logAlerter.checkLogs([]*LogsEntry{critical, outOfMemory, info}, now)
+		logAlerter.checkWindows(now.Add(time.Minute))
+		okAgainWithinWindow := len(alerter.okAgain)
+		logAlerter.checkWindows(now.Add(6 * time.Minute))
+
+		// assert
+		assert.Len(t, alerter.alerts, 1)
+		assert.Equal(t, "Log alert critical (gitlab-runner)", alerter.alerts[0].GetMetricValues().Name)
+		assert.Equal(t, 0, okAgainWithinWindow)
+		assert.Len(t, alerter.okAgain, 1)
+		assert.Equal(t, metrics.OK, alerter.okAgain[0].GetMetricValues().State)
+		assert.Empty(t, logAlerter.states)
+	})
+
+	t.Run("should count the matches per host", func(t *testing.T) {
+		// arrange
+		logAlerter, alerter := newLogAlerter(t, &LogAlertRule{Name: "oom", Regex: "Out of memory", Threshold: 2})
+		otherHost := newTestLogsEntry(map[string]any{"_HOSTNAME": "couchdb-2", "MESSAGE": "Out of memory"})
+
+		// act
+		logAlerter.checkLogs([]*LogsEntry{outOfMemory, otherHost}, now)
+
+		// assert
+		assert.Empty(t, alerter.alerts)
+	})
+
+	t.Run("should not block when the queue is full", func(t *testing.T) {
+		// arrange
+		logAlerter, _ := newLogAlerter(t, &LogAlertRule{Name: "oom", Regex: "Out of memory"})
+
+		// act
+		for i := 0; i < logAlertQueueSize+1; i++ {
+			logAlerter.LogsInserted([]*LogsEntry{outOfMemory})
+		}
+
+		// assert
+		assert.Len(t, logAlerter.queue, logAlertQueueSize)
+	})
+}
+
+func TestLoadLogAlertRules(t *testing.T) {
+	t.Run("should load and validate the rules", func(t *testing.T) {
+		// arrange
+		file := filepath.Join(t.TempDir(), "log-alerts.json")
+		err := os.WriteFile(file, []byte(`[{"name": "oom", "regex": "Out of memory", "host": "couchdb-1"}]`), 0600)
+		assert.NoError(t, err)
+
+		// act
+		rules, err := LoadLogAlertRules(file)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Len(t, rules, 1)
+		assert.Equal(t, 1, rules[0].Threshold)
+		assert.Equal(t, defaultLogAlertWindowMinutes, rules[0].WindowMinutes)
+	})
+
+	t.Run("should reject invalid rules", func(t *testing.T) {
+		invalid := []string{
+			`[{"regex": "x"}]`,
+			`[{"name": "a"}]`,
+			`[{"name": "a", "regex": "("}]`,
+			`[{"name": "a", "query": "PRIORITY<=x"}]`,
+			`[{"name": "a", "regex": "x", "threshold": -1}]`,
+			`[{"name": "a", "regex": "x"}, {"name": "a", "regex": "y"}]`,
+		}
+		for _, content := range invalid {
+			file := filepath.Join(t.TempDir(), "log-alerts.json")
+			assert.NoError(t, os.WriteFile(file, []byte(content), 0600))
+			_, err := LoadLogAlertRules(file)
+			assert.Error(t, err, content)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package journal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogCursor is the position of a log in the order of time and id. The page of a cursor starts
+// after the log, or ends before it if Before is set.
+type LogCursor struct {
+	Time   time.Time
+	Id     int
+	Before bool
+}
+
+func afterLog(entry LogsEntry) *LogCursor {
+	return &LogCursor{Time: entry.Time, Id: entry.Id}
+}
+
+func beforeLog(entry LogsEntry) *LogCursor {
+	return &LogCursor{Time: entry.Time, Id: entry.Id, Before: true}
+}
+
+// Encode returns the cursor as an opaque string for the URL.
+func (c *LogCursor) Encode() string {
+	direction := "a"
+	if c.Before {
+		direction = "b"
+	}
+	value := fmt.Sprintf("%v.%v.%v", direction, c.Time.UnixMicro(), c.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// DecodeLogCursor returns nil for an empty cursor.
+func DecodeLogCursor(encoded string) (*LogCursor, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", encoded)
+	}
+	parts := strings.Split(string(value), ".")
+	if len(parts) != 3 || (parts[0] != "a" && parts[0] != "b") {
+		return nil, fmt.Errorf("invalid cursor %q", encoded)
+	}
+	micros, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", encoded)
+	}
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %q", encoded)
+	}
+	return &LogCursor{Time: time.UnixMicro(micros).In(GetLocation()), Id: id, Before: parts[0] == "b"}, nil
+}
@@ -0,0 +1,128 @@
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLogCursor(t *testing.T) {
+	t.Run("should decode an encoded cursor", func(t *testing.T) {
+		// arrange
+		cursor := &LogCursor{Time: time.UnixMicro(1723552255278199).In(GetLocation()), Id: 42, Before: true}
+
+		// act
+		decoded, err := DecodeLogCursor(cursor.Encode())
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, cursor, decoded)
+	})
+
+	t.Run("should return nil for an empty cursor", func(t *testing.T) {
+		// act
+		cursor, err := DecodeLogCursor("")
+
+		// assert
+		assert.NoError(t, err)
+		assert.Nil(t, cursor)
+	})
+
+	t.Run("should reject invalid cursors", func(t *testing.T) {
+		for _, encoded := range []string{"not base64!", "YS4xMjM", "eC4xMjMuNA", "YS54LjQ"} {
+			_, err := DecodeLogCursor(encoded)
+			assert.Error(t, err, encoded)
+		}
+	})
+}
+
+func TestLogPage(t *testing.T) {
+	start := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	cursorTime := start.Add(time.Minute)
+
+	t.Run("should select the logs after the cursor", func(t *testing.T) {
+		// arrange
+		data := &LogPageData{StartTime: start, EndTime: end, Limit: 10, Cursor: &LogCursor{Time: cursorTime, Id: 7}}
+
+		// act
+		sql, args, err := logPageSql(data)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT "id", "time", "hash", "log" FROM "logs" WHERE (("time" >= $1) AND ("time" <= $2) AND ("time" >= $3) AND ("time", "id") > ($4, $5)) ORDER BY "time" ASC, "id" ASC LIMIT $6`, sql)
+		assert.Equal(t, []any{start, end, cursorTime, cursorTime, int64(7), int64(11)}, args)
+	})
+
+	t.Run("should reverse the order to select the logs before the cursor", func(t *testing.T) {
+		// arrange
+		data := &LogPageData{StartTime: start, EndTime: end, Limit: 10, Descending: true, Cursor: &LogCursor{Time: cursorTime, Id: 7, Before: true}}
+
+		// act
+		sql, _, err := logPageSql(data)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Contains(t, sql, `("time" >= $3) AND ("time", "id") > ($4, $5)) ORDER BY "time" ASC, "id" ASC`)
+	})
+
+	t.Run("should select the newest logs first", func(t *testing.T) {
+		// arrange
+		data := &LogPageData{StartTime: start, EndTime: end, Limit: 10, Descending: true, Cursor: &LogCursor{Time: cursorTime, Id: 7}}
+
+		// act
+		sql, _, err := logPageSql(data)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Contains(t, sql, `("time" <= $3) AND ("time", "id") < ($4, $5)) ORDER BY "time" DESC, "id" DESC`)
+	})
+
+	entries := func(ids ...int) []LogsEntry {
+		result := make([]LogsEntry, 0)
+		for _, id := range ids {
+			result = append(result, LogsEntry{Id: id, Time: start.Add(time.Duration(id) * time.Second)})
+		}
+		return result
+	}
+
+	t.Run("should only have a next cursor on the first page", func(t *testing.T) {
+		// act
+		page := newLogPage(entries(1, 2, 3), &LogPageData{Limit: 2})
+
+		// assert
+		assert.Equal(t, entries(1, 2), page.Entries)
+		assert.Equal(t, afterLog(entries(2)[0]), page.Next)
+		assert.Nil(t, page.Previous)
+	})
+
+	t.Run("should have no next cursor on the last page", func(t *testing.T) {
+		// act
+		page := newLogPage(entries(3, 4), &LogPageData{Limit: 2, Cursor: afterLog(entries(2)[0])})
+
+		// assert
+		assert.Equal(t, entries(3, 4), page.Entries)
+		assert.Nil(t, page.Next)
+		assert.Equal(t, beforeLog(entries(3)[0]), page.Previous)
+	})
+
+	t.Run("should restore the order of the logs before the cursor", func(t *testing.T) {
+		// act
+		page := newLogPage(entries(4, 3, 2), &LogPageData{Limit: 2, Cursor: beforeLog(entries(5)[0])})
+
+		// assert
+		assert.Equal(t, entries(3, 4), page.Entries)
+		assert.Equal(t, afterLog(entries(4)[0]), page.Next)
+		assert.Equal(t, beforeLog(entries(3)[0]), page.Previous)
+	})
+
+	t.Run("should have no previous cursor when going back to the first page", func(t *testing.T) {
+		// act
+		page := newLogPage(entries(2, 1), &LogPageData{Limit: 2, Cursor: beforeLog(entries(3)[0])})
+
+		// assert
+		assert.Equal(t, entries(1, 2), page.Entries)
+		assert.Nil(t, page.Previous)
+		assert.NotNil(t, page.Next)
+	})
+}
@@ -0,0 +1,102 @@
+package journal
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const messageRawField = "MESSAGE_RAW"
+
+// ansiEscapePattern matches CSI sequences like colors, OSC sequences like titles and the other
+// two character escape sequences.
+var ansiEscapePattern = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// decodeJournalFields decodes the fields that journald sends as byte array, because they are not
+// valid UTF-8 or contain control characters. Multi-valued fields are decoded per value. It is
+// only used for the logs of journald, other sources like OTLP can have arrays of numbers.
+func decodeJournalFields(logMap map[string]any) {
+	for field, value := range logMap {
+		logMap[field] = decodeJournalValue(value)
+	}
+}
+
+func decodeJournalValue(value any) any {
+	values, ok := value.([]any)
+	if !ok {
+		return value
+	}
+	if text, ok := decodeByteArray(values); ok {
+		return text
+	}
+	decoded := make([]any, len(values))
+	for i, element := range values {
+		decoded[i] = decodeJournalValue(element)
+	}
+	return decoded
+}
+
+// normalizeLogFields removes NUL characters, because Postgres can't store them in jsonb, and
+// replaces invalid UTF-8. If stripAnsi is set, the MESSAGE is saved without ANSI escape
+// sequences and the original one as MESSAGE_RAW.
+func normalizeLogFields(logMap map[string]any, stripAnsi bool) {
+	for field, value := range logMap {
+		logMap[field] = normalizeLogValue(value)
+	}
+	if !stripAnsi {
+		return
+	}
+	message, ok := logMap[messageField].(string)
+	if !ok {
+		return
+	}
+	stripped := ansiEscapePattern.ReplaceAllString(message, "")
+	if stripped != message {
+		logMap[messageField] = stripped
+		logMap[messageRawField] = message
+	}
+}
+
+func normalizeLogValue(value any) any {
+	switch value := value.(type) {
+	case string:
+		return cleanLogText(value)
+	case []any:
+		values := make([]any, len(value))
+		for i, element := range value {
+			values[i] = normalizeLogValue(element)
+		}
+		return values
+	case map[string]any:
+		normalized := make(map[string]any, len(value))
+		for key, element := range value {
+			normalized[cleanLogText(key)] = normalizeLogValue(element)
+		}
+		return normalized
+	}
+	return value
+}
+
+// decodeByteArray returns false if the value is not an array of bytes.
+func decodeByteArray(value []any) (string, bool) {
+	if len(value) == 0 {
+		return "", false
+	}
+	bytes := make([]byte, len(value))
+	for i, element := range value {
+		number, ok := element.(float64)
+		if !ok || number < 0 || number > 255 || number != float64(int(number)) {
+			return "", false
+		}
+		bytes[i] = byte(number)
+	}
+	return cleanLogText(string(bytes)), true
+}
+
+// cleanLogText replaces invalid UTF-8 with the replacement character and removes NUL.
+func cleanLogText(text string) string {
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "�")
+	}
+	return strings.ReplaceAll(text, "\x00", "")
+}
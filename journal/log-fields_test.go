@@ -0,0 +1,109 @@
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDecodeJournalFields(t *testing.T) {
+	t.Run("should decode byte array fields", func(t *testing.T) {
+		// arrange
+		entry, err := ParseJournalLogLine(`{"__REALTIME_TIMESTAMP":"1723796509016948","MESSAGE":[67,104,101,99,107,27,91,48,59,109,32,106,111,98],"PRIORITY":"3"}`)
+		assert.NoError(t, err)
+
+		// act
+		decodeJournalFields(entry.Log)
+
+		// assert
+		assert.Equal(t, "Check\x1b[0;m job", entry.Log["MESSAGE"])
+		assert.Equal(t, "3", entry.Log["PRIORITY"])
+		assert.NotContains(t, entry.Log, "MESSAGE_RAW")
+	})
+
+	t.Run("should replace invalid UTF-8 in decoded fields", func(t *testing.T) {
+		// arrange
+		logMap := map[string]any{"MESSAGE": []any{float64(97), float64(0), float64(255), float64(98)}}
+
+		// act
+		decodeJournalFields(logMap)
+
+		// assert
+		assert.Equal(t, "a�b", logMap["MESSAGE"])
+	})
+
+	t.Run("should decode the values of multi-valued fields", func(t *testing.T) {
+		// arrange
+		logMap := map[string]any{"TAG": []any{"first", []any{float64(104), float64(105)}}}
+
+		// act
+		decodeJournalFields(logMap)
+
+		// assert
+		assert.Equal(t, []any{"first", "hi"}, logMap["TAG"])
+	})
+
+	t.Run("should keep arrays that are not bytes", func(t *testing.T) {
+		// arrange
+		logMap := map[string]any{"VALUES": []any{float64(1), float64(1000)}, "EMPTY": []any{}}
+
+		// act
+		decodeJournalFields(logMap)
+
+		// assert
+		assert.Equal(t, []any{float64(1), float64(1000)}, logMap["VALUES"])
+		assert.Equal(t, []any{}, logMap["EMPTY"])
+	})
+}
+
+func TestNormalizeLogFields(t *testing.T) {
+	t.Run("should strip the ANSI escape sequences and keep the raw message", func(t *testing.T) {
+		// arrange
+		logMap := map[string]any{"MESSAGE": "\x1b[1;31merror\x1b[0m: \x1b]0;title\x07failed"}
+
+		// act
+		normalizeLogFields(logMap, true)
+
+		// assert
+		assert.Equal(t, "error: failed", logMap["MESSAGE"])
+		assert.Equal(t, "\x1b[1;31merror\x1b[0m: \x1b]0;title\x07failed", logMap["MESSAGE_RAW"])
+	})
+
+	t.Run("should not add a raw message without escape sequences", func(t *testing.T) {
+		// arrange
+		logMap := map[string]any{"MESSAGE": "plain"}
+
+		// act
+		normalizeLogFields(logMap, true)
+
+		// assert
+		assert.Equal(t, map[string]any{"MESSAGE": "plain"}, logMap)
+	})
+
+	t.Run("should remove NUL and replace invalid UTF-8", func(t *testing.T) {
+		// arrange
+		logMap := map[string]any{
+			"MESSAGE":    "a\x00\xffb",
+			"_CMDLINE":   []any{"a\x00b"},
+			"attributes": map[string]any{"key": "c\x00d"},
+		}
+
+		// act
+		normalizeLogFields(logMap, false)
+
+		// assert
+		assert.Equal(t, "a�b", logMap["MESSAGE"])
+		assert.Equal(t, []any{"ab"}, logMap["_CMDLINE"])
+		assert.Equal(t, map[string]any{"key": "cd"}, logMap["attributes"])
+	})
+
+	t.Run("should keep arrays of numbers like the ones of OTLP", func(t *testing.T) {
+		// arrange
+		logMap := map[string]any{"codes": []any{float64(104), float64(105)}}
+
+		// act
+		normalizeLogFields(logMap, false)
+
+		// assert
+		assert.Equal(t, []any{float64(104), float64(105)}, logMap["codes"])
+	})
+}
@@ -0,0 +1,271 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"strings"
+	"time"
+)
+
+const (
+	maxHistogramBars     = 60
+	histogramWidth       = 1000
+	histogramHeight      = 100
+	maxHistogramLabels   = 6
+	lastHistogramLabelAt = 90
+)
+
+var histogramBucketSizes = []time.Duration{
+	time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 2 * time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// time_bucket aligns buckets of less than a month to this origin, with a timezone to midnight of
+// this date in the timezone
+var timeBucketOrigin = time.Date(2000, 1, 3, 0, 0, 0, 0, time.UTC)
+
+// LogCount is the number of logs with the priority in the bucket starting at Start.
+type LogCount struct {
+	Start    time.Time
+	Priority string
+	Count    int
+}
+
+// HistogramBucketSize returns the smallest bucket size for which the range has at most
+// maxHistogramBars buckets.
+func HistogramBucketSize(start time.Time, end time.Time) time.Duration {
+	for _, size := range histogramBucketSizes {
+		if end.Sub(start)/size < maxHistogramBars {
+			return size
+		}
+	}
+	return histogramBucketSizes[len(histogramBucketSizes)-1]
+}
+
+// GetLogCounts counts the logs matching the filters of the data per bucket and priority.
+func (s *JournalLogService) GetLogCounts(data *LogPageData, bucketSize time.Duration) ([]LogCount, error) {
+	data = setDefaultLogPageData(data)
+	sql, args, err := logCountsSql(data, bucketSize)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.connPool.Query(context.Background(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make([]LogCount, 0)
+	for rows.Next() {
+		var count LogCount
+		var priority *string
+		if err := rows.Scan(&count.Start, &priority, &count.Count); err != nil {
+			return nil, err
+		}
+		if priority != nil {
+			count.Priority = *priority
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// logCountsSql buckets whole days in the timezone of the start, so that they begin at midnight
+// and daylight saving time changes are respected.
+func logCountsSql(data *LogPageData, bucketSize time.Duration) (string, []any, error) {
+	bucket := goqu.L("time_bucket(?::interval, time)", fmt.Sprintf("%d seconds", int64(bucketSize.Seconds())))
+	if location := dayBucketLocation(data.StartTime.Location(), bucketSize); location != nil {
+		bucket = goqu.L("time_bucket(?::interval, time, ?::text)", fmt.Sprintf("%d days", bucketDays(bucketSize)), location.String())
+	}
+	return goqu.Dialect("postgres").From("logs").
+		Prepared(true).
+		Select(
+			bucket.As("bucket"),
+			goqu.L("log->>'PRIORITY'").As("priority"),
+			goqu.COUNT("*").As("count"),
+		).
+		Where(logPageFilter(data)).
+		GroupBy(goqu.I("bucket"), goqu.I("priority")).
+		Order(goqu.I("bucket").Asc()).
+		ToSQL()
+}
+
+// LogHistogram is the data of the SVG bar chart above the journal table. The coordinates are
+// calculated here, so that the template only has to draw them.
+type LogHistogram struct {
+	Width       int
+	Height      int
+	MaxCount    int
+	TotalCount  int
+	BucketLabel string
+	Bars        []HistogramBar
+	Labels      []HistogramLabel
+	Legend      []HistogramLegendEntry
+}
+
+type HistogramBar struct {
+	X        float64
+	Width    float64
+	Url      string
+	Title    string
+	Segments []HistogramSegment
+}
+
+type HistogramSegment struct {
+	Y      float64
+	Height float64
+	Color  string
+}
+
+// HistogramLabel is shown below the chart, Left is in percent of its width.
+type HistogramLabel struct {
+	Left float64
+	Text string
+}
+
+type HistogramLegendEntry struct {
+	Label string
+	Color string
+}
+
+// NewLogHistogram creates a bar for every bucket between start and end, also for the empty
+// ones. url returns the link of a bar that narrows the view to the bucket.
+func NewLogHistogram(counts []LogCount, start time.Time, end time.Time, bucketSize time.Duration, url func(bucketStart time.Time, bucketEnd time.Time) string) *LogHistogram {
+	countsPerBucket := make(map[int64]map[string]int)
+	usedPriorities := make(map[string]bool)
+	histogram := &LogHistogram{
+		Width:       histogramWidth,
+		Height:      histogramHeight,
+		BucketLabel: formatBucketSize(bucketSize),
+	}
+	for _, count := range counts {
+		priority := getLogPriority(count.Priority).value
+		key := count.Start.UnixMilli()
+		if countsPerBucket[key] == nil {
+			countsPerBucket[key] = make(map[string]int)
+		}
+		countsPerBucket[key][priority] += count.Count
+		usedPriorities[priority] = true
+		histogram.TotalCount += count.Count
+	}
+
+	bucketStarts := make([]time.Time, 0)
+	for bucketStart := alignToBucket(start, bucketSize); !bucketStart.After(end); bucketStart = nextBucket(bucketStart, bucketSize) {
+		bucketStarts = append(bucketStarts, bucketStart)
+	}
+	for _, bucketCounts := range countsPerBucket {
+		total := 0
+		for _, count := range bucketCounts {
+			total += count
+		}
+		histogram.MaxCount = max(histogram.MaxCount, total)
+	}
+
+	barWidth := float64(histogramWidth) / float64(max(len(bucketStarts), 1))
+	location := start.Location()
+	for i, bucketStart := range bucketStarts {
+		bar := HistogramBar{
+			X:     float64(i) * barWidth,
+			Width: barWidth,
+			Url:   url(bucketStart, nextBucket(bucketStart, bucketSize)),
+		}
+		bucketCounts := countsPerBucket[bucketStart.UnixMilli()]
+		y := float64(histogramHeight)
+		titleCounts := make([]string, 0)
+		total := 0
+		for _, priority := range logPriorities {
+			count := bucketCounts[priority.value]
+			if count == 0 {
+				continue
+			}
+			total += count
+			height := float64(count) / float64(histogram.MaxCount) * histogramHeight
+			y -= height
+			bar.Segments = append(bar.Segments, HistogramSegment{Y: y, Height: height, Color: priority.color})
+			titleCounts = append(titleCounts, fmt.Sprintf("%v %v", count, priority.label))
+		}
+		bar.Title = fmt.Sprintf("%v: %v logs", bucketStart.In(location).Format("02.01.2006 15:04"), total)
+		if len(titleCounts) > 0 {
+			bar.Title += fmt.Sprintf(" (%v)", strings.Join(titleCounts, ", "))
+		}
+		histogram.Bars = append(histogram.Bars, bar)
+	}
+
+	// the last label is left out if it would overflow the chart
+	labelEvery := max(len(bucketStarts)/maxHistogramLabels, 1)
+	for i := 0; i < len(bucketStarts); i += labelEvery {
+		left := float64(i) * barWidth / histogramWidth * 100
+		if left > lastHistogramLabelAt {
+			break
+		}
+		histogram.Labels = append(histogram.Labels, HistogramLabel{
+			Left: left,
+			Text: bucketStarts[i].In(location).Format(histogramLabelFormat(bucketSize)),
+		})
+	}
+
+	for _, priority := range logPriorities {
+		if usedPriorities[priority.value] {
+			histogram.Legend = append(histogram.Legend, HistogramLegendEntry{Label: priority.label, Color: priority.color})
+		}
+	}
+	return histogram
+}
+
+// dayBucketLocation returns the timezone of buckets of whole days or nil if they are aligned to
+// UTC. The local timezone of the server is left out, because Postgres doesn't know its name.
+func dayBucketLocation(location *time.Location, bucketSize time.Duration) *time.Location {
+	if bucketSize < 24*time.Hour || bucketSize%(24*time.Hour) != 0 || location == time.Local {
+		return nil
+	}
+	return location
+}
+
+func bucketDays(bucketSize time.Duration) int {
+	return int(bucketSize / (24 * time.Hour))
+}
+
+// alignToBucket returns the start of the bucket of the value like time_bucket does.
+func alignToBucket(value time.Time, bucketSize time.Duration) time.Time {
+	if location := dayBucketLocation(value.Location(), bucketSize); location != nil {
+		local := value.In(location)
+		date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+		days := int(date.Sub(timeBucketOrigin) / (24 * time.Hour))
+		days -= ((days % bucketDays(bucketSize)) + bucketDays(bucketSize)) % bucketDays(bucketSize)
+		origin := time.Date(timeBucketOrigin.Year(), timeBucketOrigin.Month(), timeBucketOrigin.Day(), 0, 0, 0, 0, location)
+		return origin.AddDate(0, 0, days)
+	}
+	buckets := value.Sub(timeBucketOrigin) / bucketSize
+	aligned := timeBucketOrigin.Add(buckets * bucketSize)
+	if aligned.After(value) {
+		aligned = aligned.Add(-bucketSize)
+	}
+	return aligned.In(value.Location())
+}
+
+// nextBucket returns the start of the following bucket. A day bucket is shorter or longer than
+// 24 hours when daylight saving time changes.
+func nextBucket(bucketStart time.Time, bucketSize time.Duration) time.Time {
+	if dayBucketLocation(bucketStart.Location(), bucketSize) != nil {
+		return bucketStart.AddDate(0, 0, bucketDays(bucketSize))
+	}
+	return bucketStart.Add(bucketSize)
+}
+
+func histogramLabelFormat(bucketSize time.Duration) string {
+	if bucketSize >= 24*time.Hour {
+		return "02.01."
+	}
+	return "02.01. 15:04"
+}
+
+func formatBucketSize(bucketSize time.Duration) string {
+	switch {
+	case bucketSize >= 24*time.Hour:
+		return fmt.Sprintf("%vd", int(bucketSize.Hours()/24))
+	case bucketSize >= time.Hour:
+		return fmt.Sprintf("%vh", int(bucketSize.Hours()))
+	default:
+		return fmt.Sprintf("%vm", int(bucketSize.Minutes()))
+	}
+}
@@ -0,0 +1,166 @@
+package journal
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHistogramBucketSize(t *testing.T) {
+	start := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+
+	t.Run("should use the smallest bucket size with at most 60 bars", func(t *testing.T) {
+		assert.Equal(t, time.Minute, HistogramBucketSize(start, start.Add(10*time.Minute)))
+		assert.Equal(t, 2*time.Minute, HistogramBucketSize(start, start.Add(time.Hour)))
+		assert.Equal(t, 30*time.Minute, HistogramBucketSize(start, start.Add(24*time.Hour)))
+	})
+
+	t.Run("should use the largest bucket size for long ranges", func(t *testing.T) {
+		assert.Equal(t, 7*24*time.Hour, HistogramBucketSize(start, start.Add(5*365*24*time.Hour)))
+	})
+}
+
+func TestLogCounts(t *testing.T) {
+	t.Run("should count the logs per bucket and priority", func(t *testing.T) {
+		// arrange
+		start := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+		end := start.Add(time.Hour)
+		data := &LogPageData{StartTime: start, EndTime: end, Hostname: "server"}
+
+		// act
+		sql, args, err := logCountsSql(data, 2*time.Minute)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT time_bucket($1::interval, time) AS "bucket", log->>'PRIORITY' AS "priority", COUNT(*) AS "count" FROM "logs" WHERE (("time" >= $2) AND ("time" <= $3) AND (log->>'_HOSTNAME' = $4)) GROUP BY "bucket", "priority" ORDER BY "bucket" ASC`, sql)
+		assert.Equal(t, []any{"120 seconds", start, end, "server"}, args)
+	})
+
+	t.Run("should bucket days in the timezone of the view", func(t *testing.T) {
+		// arrange
+		location, err := time.LoadLocation("Europe/Berlin")
+		assert.NoError(t, err)
+		start := time.Date(2024, 3, 1, 0, 0, 0, 0, location)
+		end := start.AddDate(0, 1, 0)
+		data := &LogPageData{StartTime: start, EndTime: end}
+
+		// act
+		sql, args, err := logCountsSql(data, 7*24*time.Hour)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Contains(t, sql, `SELECT time_bucket($1::interval, time, $2::text) AS "bucket"`)
+		assert.Equal(t, []any{"7 days", "Europe/Berlin", start, end}, args)
+	})
+}
+
+func TestNewLogHistogram(t *testing.T) {
+	start := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Minute)
+	url := func(bucketStart time.Time, bucketEnd time.Time) string {
+		return fmt.Sprintf("%v-%v", bucketStart.Format("15:04"), bucketEnd.Format("15:04"))
+	}
+
+	t.Run("should create a bar for every bucket", func(t *testing.T) {
+		// act
+		histogram := NewLogHistogram(nil, start, end, time.Minute, url)
+
+		// assert
+		assert.Len(t, histogram.Bars, 11)
+		assert.Equal(t, 0, histogram.TotalCount)
+		assert.Empty(t, histogram.Bars[0].Segments)
+		assert.Equal(t, "10:00-10:01", histogram.Bars[0].Url)
+		assert.Equal(t, "10:10-10:11", histogram.Bars[10].Url)
+		assert.Equal(t, "1m", histogram.BucketLabel)
+	})
+
+	t.Run("should stack the priorities with the most severe at the bottom", func(t *testing.T) {
+		// arrange
+		counts := []LogCount{
+			{Start: start.Add(time.Minute), Priority: "6", Count: 6},
+			{Start: start.Add(time.Minute), Priority: "3", Count: 2},
+			{Start: start.Add(2 * time.Minute), Priority: "6", Count: 4},
+		}
+
+		// act
+		histogram := NewLogHistogram(counts, start, end, time.Minute, url)
+
+		// assert
+		assert.Equal(t, 12, histogram.TotalCount)
+		assert.Equal(t, 8, histogram.MaxCount)
+		bar := histogram.Bars[1]
+		assert.Equal(t, []HistogramSegment{
+			{Y: 75, Height: 25, Color: "#ef4444"},
+			{Y: 0, Height: 75, Color: "#3b82f6"},
+		}, bar.Segments)
+		assert.Equal(t, "12.08.2024 10:01: 8 logs (2 err, 6 info)", bar.Title)
+		assert.Equal(t, []HistogramSegment{{Y: 50, Height: 50, Color: "#3b82f6"}}, histogram.Bars[2].Segments)
+		assert.Equal(t, []HistogramLegendEntry{{Label: "err", Color: "#ef4444"}, {Label: "info", Color: "#3b82f6"}}, histogram.Legend)
+	})
+
+	t.Run("should count logs without a valid priority as unknown", func(t *testing.T) {
+		// arrange
+		counts := []LogCount{
+			{Start: start, Priority: "", Count: 1},
+			{Start: start, Priority: "warn", Count: 1},
+		}
+
+		// act
+		histogram := NewLogHistogram(counts, start, end, time.Minute, url)
+
+		// assert
+		assert.Equal(t, []HistogramSegment{{Y: 0, Height: 100, Color: "#d1d5db"}}, histogram.Bars[0].Segments)
+		assert.Equal(t, []HistogramLegendEntry{{Label: "unknown", Color: "#d1d5db"}}, histogram.Legend)
+	})
+
+	t.Run("should align the first bucket like time_bucket", func(t *testing.T) {
+		// act
+		histogram := NewLogHistogram(nil, start.Add(7*time.Minute), start.Add(3*time.Hour), time.Hour, url)
+
+		// assert
+		assert.Equal(t, "10:00-11:00", histogram.Bars[0].Url)
+		assert.Len(t, histogram.Bars, 4)
+	})
+
+	t.Run("should start day buckets at midnight across a daylight saving time change", func(t *testing.T) {
+		// arrange
+		location, err := time.LoadLocation("Europe/Berlin")
+		assert.NoError(t, err)
+		dayUrl := func(bucketStart time.Time, bucketEnd time.Time) string {
+			return fmt.Sprintf("%v-%v", bucketStart.Format("02.01. 15:04"), bucketEnd.Format("02.01. 15:04"))
+		}
+		// the clocks were put forward on the 31st of March
+		counts := []LogCount{{Start: time.Date(2024, 3, 31, 0, 0, 0, 0, location), Priority: "6", Count: 5}}
+
+		// act
+		histogram := NewLogHistogram(counts, time.Date(2024, 3, 29, 12, 0, 0, 0, location), time.Date(2024, 4, 2, 12, 0, 0, 0, location), 24*time.Hour, dayUrl)
+
+		// assert
+		urls := make([]string, 0)
+		for _, bar := range histogram.Bars {
+			urls = append(urls, bar.Url)
+		}
+		assert.Equal(t, []string{
+			"29.03. 00:00-30.03. 00:00",
+			"30.03. 00:00-31.03. 00:00",
+			"31.03. 00:00-01.04. 00:00",
+			"01.04. 00:00-02.04. 00:00",
+			"02.04. 00:00-03.04. 00:00",
+		}, urls)
+		assert.Len(t, histogram.Bars[2].Segments, 1)
+		assert.Equal(t, "31.03.", histogram.Labels[2].Text)
+	})
+
+	t.Run("should align week buckets to the monday of the origin", func(t *testing.T) {
+		// arrange
+		location, err := time.LoadLocation("Europe/Berlin")
+		assert.NoError(t, err)
+
+		// act
+		aligned := alignToBucket(time.Date(2024, 8, 15, 1, 30, 0, 0, location), 7*24*time.Hour)
+
+		// assert
+		assert.Equal(t, time.Date(2024, 8, 12, 0, 0, 0, 0, location), aligned)
+	})
+}
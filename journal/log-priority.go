@@ -0,0 +1,75 @@
+package journal
+
+import (
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"strconv"
+)
+
+const (
+	priorityField = "PRIORITY"
+	// ErrorPriority is the least severe priority shown by the errors only filter.
+	ErrorPriority = 3
+)
+
+type logPriority struct {
+	value    string
+	label    string
+	color    string
+	rowClass string
+}
+
+// logPriorities are the syslog priorities of journald, the most severe first. Logs without a
+// valid PRIORITY are unknown.
+var logPriorities = []logPriority{
+	{"0", "emerg", "#7f1d1d", "bg-red-100 dark:bg-red-950"},
+	{"1", "alert", "#991b1b", "bg-red-100 dark:bg-red-950"},
+	{"2", "crit", "#b91c1c", "bg-red-100 dark:bg-red-950"},
+	{"3", "err", "#ef4444", "bg-red-50 dark:bg-red-900"},
+	{"4", "warning", "#f59e0b", "bg-yellow-50 dark:bg-yellow-900"},
+	{"5", "notice", "#0ea5e9", "bg-white dark:bg-gray-800"},
+	{"6", "info", "#3b82f6", "bg-white dark:bg-gray-800"},
+	{"7", "debug", "#9ca3af", "bg-white dark:bg-gray-800"},
+	{"", "unknown", "#d1d5db", "bg-white dark:bg-gray-800"},
+}
+
+func getLogPriority(value string) logPriority {
+	for _, priority := range logPriorities {
+		if priority.value == value {
+			return priority
+		}
+	}
+	return logPriorities[len(logPriorities)-1]
+}
+
+// ParseMaxPriority returns nil for an empty value, which shows the logs of all priorities.
+func ParseMaxPriority(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	priority, err := strconv.Atoi(value)
+	if err != nil || priority < 0 || priority > 7 {
+		return nil, fmt.Errorf("invalid priority %q, must be between 0 and 7", value)
+	}
+	return &priority, nil
+}
+
+// priorityMatches is false for logs without a valid priority.
+func priorityMatches(entry *LogsEntry, maxPriority *int) bool {
+	if maxPriority == nil {
+		return true
+	}
+	priority, err := strconv.Atoi(logField(entry, priorityField))
+	return err == nil && priority >= 0 && priority <= *maxPriority
+}
+
+// maxPriorityExpression compares the PRIORITY as text, so that logs with an invalid priority
+// don't fail the query.
+func maxPriorityExpression(maxPriority int) exp.Expression {
+	values := make([]string, 0, maxPriority+1)
+	for priority := 0; priority <= maxPriority; priority++ {
+		values = append(values, strconv.Itoa(priority))
+	}
+	return goqu.L("log->>'PRIORITY'").In(values)
+}
@@ -0,0 +1,85 @@
+package journal
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLogPriority(t *testing.T) {
+	warning := 4
+
+	t.Run("should parse the max priority", func(t *testing.T) {
+		maxPriority, err := ParseMaxPriority("4")
+		assert.NoError(t, err)
+		assert.Equal(t, &warning, maxPriority)
+
+		maxPriority, err = ParseMaxPriority("")
+		assert.NoError(t, err)
+		assert.Nil(t, maxPriority)
+
+		for _, value := range []string{"-1", "8", "err"} {
+			_, err = ParseMaxPriority(value)
+			assert.Error(t, err, value)
+		}
+	})
+
+	t.Run("should select the logs of the priority and the more severe ones", func(t *testing.T) {
+		// arrange
+		start := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+		data := &LogPageData{StartTime: start, EndTime: start.Add(time.Hour), Limit: 10, MaxPriority: &warning}
+
+		// act
+		sql, args, err := logPageSql(data)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Contains(t, sql, `(log->>'PRIORITY' IN ($3, $4, $5, $6, $7))`)
+		assert.Equal(t, []any{"0", "1", "2", "3", "4"}, args[2:7])
+	})
+
+	t.Run("should match the live tail logs by priority", func(t *testing.T) {
+		// arrange
+		filter := LogFilter{MaxPriority: &warning}
+
+		// assert
+		assert.True(t, filter.Matches(newTestLogsEntry(map[string]any{"PRIORITY": "3"})))
+		assert.True(t, filter.Matches(newTestLogsEntry(map[string]any{"PRIORITY": "4"})))
+		assert.False(t, filter.Matches(newTestLogsEntry(map[string]any{"PRIORITY": "6"})))
+		assert.False(t, filter.Matches(newTestLogsEntry(map[string]any{"MESSAGE": "no priority"})))
+		assert.True(t, LogFilter{}.Matches(newTestLogsEntry(map[string]any{"MESSAGE": "no priority"})))
+	})
+
+	t.Run("should limit the priority to the errors if errors only is set", func(t *testing.T) {
+		critical := 2
+		assert.Equal(t, ErrorPriority, *(&JournalRenderData{ErrorsOnly: true}).effectiveMaxPriority())
+		assert.Equal(t, ErrorPriority, *(&JournalRenderData{ErrorsOnly: true, MaxPriority: &warning}).effectiveMaxPriority())
+		assert.Equal(t, critical, *(&JournalRenderData{ErrorsOnly: true, MaxPriority: &critical}).effectiveMaxPriority())
+		assert.Equal(t, &warning, (&JournalRenderData{MaxPriority: &warning}).effectiveMaxPriority())
+	})
+
+	t.Run("should show the severity and color the row", func(t *testing.T) {
+		// arrange
+		entry := newTestLogsEntry(map[string]any{"PRIORITY": "3", "MESSAGE": "failed"})
+
+		// act
+		row, err := CreateJournalRow(entry, "nginx", nil)
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, textCell("err"), row.Cells[1])
+		assert.Equal(t, "#ef4444", row.Color)
+		assert.Equal(t, "bg-red-50 dark:bg-red-900", row.Class)
+	})
+
+	t.Run("should offer the priorities with the more severe ones", func(t *testing.T) {
+		// act
+		input := createMaxPrioritySelect(&warning)
+
+		// assert
+		assert.Len(t, input.Options, 9)
+		assert.Equal(t, SelectOption{Value: "", Label: "All"}, input.Options[0])
+		assert.Equal(t, SelectOption{Value: "0", Label: "emerg"}, input.Options[1])
+		assert.Equal(t, SelectOption{Value: "4", Label: "warning and worse", Selected: true}, input.Options[5])
+	})
+}
@@ -0,0 +1,199 @@
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/gorlug/metrics-backend/stats"
+	"log"
+	"os"
+	"time"
+)
+
+var logsDeletedTotal = stats.NewCounter("metrics_backend_logs_deleted_total", "Number of logs that were deleted by the retention rules.")
+
+// DefaultRetentionDays is used for the logs that no rule matches. It was the retention policy of
+// the hypertable before the rules.
+const DefaultRetentionDays = 7
+
+// RetentionRule keeps the logs of the host and container for Days. Host and Container limit the
+// rule to the logs of a host or container, empty matches all.
+type RetentionRule struct {
+	Host      string `json:"host"`
+	Container string `json:"container"`
+	Days      int    `json:"days"`
+}
+
+func (r RetentionRule) matchesAll() bool {
+	return r.Host == "" && r.Container == ""
+}
+
+func (r RetentionRule) matches(host string, container string) bool {
+	return (r.Host == "" || r.Host == host) && (r.Container == "" || r.Container == container)
+}
+
+// expression is nil for a rule that matches all logs. Missing fields are compared as empty, so
+// that the negation of the expression is never null.
+func (r RetentionRule) expression() exp.Expression {
+	and := goqu.And()
+	if r.Host != "" {
+		and = and.Append(goqu.L("coalesce(log->>'_HOSTNAME', '')").Eq(r.Host))
+	}
+	if r.Container != "" {
+		and = and.Append(goqu.L("coalesce(log->>'CONTAINER_NAME', '')").Eq(r.Container))
+	}
+	if and.IsEmpty() {
+		return nil
+	}
+	return and
+}
+
+func (r RetentionRule) String() string {
+	switch {
+	case r.matchesAll():
+		return "all"
+	case r.Container == "":
+		return "host " + r.Host
+	case r.Host == "":
+		return "container " + r.Container
+	}
+	return fmt.Sprintf("container %v on host %v", r.Container, r.Host)
+}
+
+// RetentionPolicy uses the first matching rule of a log. The last rule always matches all logs.
+type RetentionPolicy struct {
+	Rules []RetentionRule
+}
+
+// NewRetentionPolicy validates the rules and adds a rule with DefaultRetentionDays for the
+// remaining logs if there is none.
+func NewRetentionPolicy(rules []RetentionRule) (*RetentionPolicy, error) {
+	for i, rule := range rules {
+		if rule.Days <= 0 {
+			return nil, fmt.Errorf("rule %v: days must be positive", i)
+		}
+		if rule.matchesAll() && i != len(rules)-1 {
+			return nil, fmt.Errorf("rule %v: only the last rule can match all logs", i)
+		}
+	}
+	if len(rules) == 0 || !rules[len(rules)-1].matchesAll() {
+		rules = append(rules, RetentionRule{Days: DefaultRetentionDays})
+	}
+	return &RetentionPolicy{Rules: rules}, nil
+}
+
+// LoadRetentionPolicy reads the rules from a JSON file. Without a file all logs are kept for
+// DefaultRetentionDays.
+func LoadRetentionPolicy(file string) (*RetentionPolicy, error) {
+	if file == "" {
+		return NewRetentionPolicy(nil)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RetentionRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %w", file, err)
+	}
+	return NewRetentionPolicy(rules)
+}
+
+func (p *RetentionPolicy) RuleFor(host string, container string) RetentionRule {
+	for _, rule := range p.Rules {
+		if rule.matches(host, container) {
+			return rule
+		}
+	}
+	return p.Rules[len(p.Rules)-1]
+}
+
+func (p *RetentionPolicy) maxDays() int {
+	maxDays := 0
+	for _, rule := range p.Rules {
+		maxDays = max(maxDays, rule.Days)
+	}
+	return maxDays
+}
+
+// deleteExpression matches the expired logs of the rule that no earlier rule matches.
+func (p *RetentionPolicy) deleteExpression(index int, now time.Time) exp.Expression {
+	rule := p.Rules[index]
+	and := goqu.And(goqu.C("time").Lt(now.Add(-days(rule.Days))))
+	if expression := rule.expression(); expression != nil {
+		and = and.Append(expression)
+	}
+	for _, earlier := range p.Rules[:index] {
+		and = and.Append(goqu.Func("NOT", earlier.expression()))
+	}
+	return and
+}
+
+func days(count int) time.Duration {
+	return time.Duration(count) * 24 * time.Hour
+}
+
+type RetentionService interface {
+	DropChunks(olderThan time.Time) error
+	DeleteLogs(where exp.Expression) (int64, error)
+}
+
+// LogRetainer deletes the expired logs. Chunks that only contain logs older than the longest
+// retention are dropped as a whole, the logs of rules with a shorter retention are deleted.
+type LogRetainer struct {
+	service RetentionService
+	policy  *RetentionPolicy
+}
+
+func NewLogRetainer(service RetentionService, policy *RetentionPolicy) *LogRetainer {
+	return &LogRetainer{service: service, policy: policy}
+}
+
+func (r *LogRetainer) DeleteExpiredLogs() {
+	r.deleteExpired(time.Now())
+}
+
+func (r *LogRetainer) deleteExpired(now time.Time) {
+	log.Println("Deleting expired logs")
+	err := r.service.DropChunks(now.Add(-days(r.policy.maxDays())))
+	if err != nil {
+		log.Println("failed to drop expired log chunks", err)
+	}
+	for i, rule := range r.policy.Rules {
+		deleted, err := r.service.DeleteLogs(r.policy.deleteExpression(i, now))
+		if err != nil {
+			log.Printf("failed to delete the expired logs of %v: %v", rule, err)
+			continue
+		}
+		logsDeletedTotal.Add(float64(deleted))
+		if deleted > 0 {
+			log.Printf("deleted %v logs of %v older than %v days", deleted, rule, rule.Days)
+		}
+	}
+}
+
+func (s *JournalLogService) DropChunks(olderThan time.Time) error {
+	_, err := s.connPool.Exec(context.Background(), "SELECT drop_chunks('logs', older_than => $1::timestamptz)", olderThan)
+	return err
+}
+
+func (s *JournalLogService) DeleteLogs(where exp.Expression) (int64, error) {
+	sql, args, err := deleteLogsSql(where)
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.connPool.Exec(context.Background(), sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+func deleteLogsSql(where exp.Expression) (string, []any, error) {
+	return goqu.Dialect("postgres").Delete("logs").
+		Prepared(true).
+		Where(where).
+		ToSQL()
+}
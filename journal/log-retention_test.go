@@ -0,0 +1,114 @@
+package journal
+
+import (
+	"fmt"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type MockRetentionService struct {
+	droppedBefore time.Time
+	deletes       []string
+	deleteArgs    [][]any
+}
+
+func (m *MockRetentionService) DropChunks(olderThan time.Time) error {
+	m.droppedBefore = olderThan
+	return nil
+}
+
+func (m *MockRetentionService) DeleteLogs(where exp.Expression) (int64, error) {
+	sql, args, err := deleteLogsSql(where)
+	if err != nil {
+		return 0, err
+	}
+	m.deletes = append(m.deletes, sql)
+	m.deleteArgs = append(m.deleteArgs, args)
+	return 1, nil
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	t.Run("should keep all logs for the default days without rules", func(t *testing.T) {
+		// act
+		policy, err := LoadRetentionPolicy("")
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, []RetentionRule{{Days: DefaultRetentionDays}}, policy.Rules)
+	})
+
+	t.Run("should use the first matching rule", func(t *testing.T) {
+		// arrange
+		policy, err := NewRetentionPolicy([]RetentionRule{
+			{Host: "audit-1", Days: 90},
+			{Container: "gitlab-runner", Days: 2},
+			{Days: 14},
+		})
+		assert.NoError(t, err)
+
+		// assert
+		assert.Len(t, policy.Rules, 3)
+		assert.Equal(t, 90, policy.RuleFor("audit-1", "gitlab-runner").Days)
+		assert.Equal(t, 2, policy.RuleFor("ci-1", "gitlab-runner").Days)
+		assert.Equal(t, 14, policy.RuleFor("ci-1", "").Days)
+	})
+
+	t.Run("should reject invalid rules", func(t *testing.T) {
+		for _, rules := range [][]RetentionRule{
+			{{Host: "audit-1"}},
+			{{Days: 7}, {Host: "audit-1", Days: 90}},
+		} {
+			_, err := NewRetentionPolicy(rules)
+			assert.Error(t, err, fmt.Sprint(rules))
+		}
+	})
+}
+
+func TestLogRetainer(t *testing.T) {
+	t.Run("should drop the old chunks and delete the expired logs of every rule", func(t *testing.T) {
+		// arrange
+		now := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+		policy, err := NewRetentionPolicy([]RetentionRule{
+			{Host: "audit-1", Days: 90},
+			{Container: "gitlab-runner", Days: 2},
+		})
+		assert.NoError(t, err)
+		service := &MockRetentionService{}
+
+		// act
+		NewLogRetainer(service, policy).deleteExpired(now)
+
+		// assert
+		assert.Equal(t, now.Add(-90*24*time.Hour), service.droppedBefore)
+		assert.Equal(t, []string{
+			`DELETE FROM "logs" WHERE (("time" < $1) AND (coalesce(log->>'_HOSTNAME', '') = $2))`,
+			`DELETE FROM "logs" WHERE (("time" < $1) AND (coalesce(log->>'CONTAINER_NAME', '') = $2) AND NOT((coalesce(log->>'_HOSTNAME', '') = $3)))`,
+			`DELETE FROM "logs" WHERE (("time" < $1) AND NOT((coalesce(log->>'_HOSTNAME', '') = $2)) AND NOT((coalesce(log->>'CONTAINER_NAME', '') = $3)))`,
+		}, service.deletes)
+		assert.Equal(t, []any{now.Add(-2 * 24 * time.Hour), "gitlab-runner", "audit-1"}, service.deleteArgs[1])
+		assert.Equal(t, now.Add(-DefaultRetentionDays*24*time.Hour), service.deleteArgs[2][0])
+	})
+
+	t.Run("should delete logs that were received after the last run but already expired", func(t *testing.T) {
+		// arrange
+		now := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+		policy, err := NewRetentionPolicy([]RetentionRule{{Container: "gitlab-runner", Days: 2}})
+		assert.NoError(t, err)
+		service := &MockRetentionService{}
+		retainer := NewLogRetainer(service, policy)
+		retainer.deleteExpired(now)
+		// e.g. a backfill of a host that was offline
+		lateLog := now.Add(-5 * 24 * time.Hour)
+
+		// act
+		retainer.deleteExpired(now.Add(time.Hour))
+
+		// assert
+		assert.Len(t, service.deletes, 4)
+		assert.Equal(t, `DELETE FROM "logs" WHERE (("time" < $1) AND (coalesce(log->>'CONTAINER_NAME', '') = $2))`, service.deletes[2])
+		assert.Equal(t, []any{now.Add(time.Hour - 2*24*time.Hour), "gitlab-runner"}, service.deleteArgs[2])
+		assert.True(t, lateLog.Before(service.deleteArgs[2][0].(time.Time)))
+	})
+}
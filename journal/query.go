@@ -0,0 +1,504 @@
+package journal
+
+import (
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a parsed filter of the journal logs like
+// PRIORITY<=3 AND _SYSTEMD_UNIT:nginx* AND NOT MESSAGE~"health". It can be compiled to a
+// parameterized SQL expression and matched against single logs.
+//
+// Supported are AND, OR, NOT, parentheses and the comparisons
+//   - FIELD:value equals, * is a wildcard, FIELD:* checks that the field exists
+//   - FIELD=value equals, FIELD!=value not equals
+//   - FIELD~regex case-insensitive regular expression, limited to the syntax that Go and
+//     Postgres interpret the same way, see validateRegex
+//   - FIELD<number, <=, >, >= numeric comparisons
+//
+// A term without a field searches the MESSAGE for the word or for the quoted phrase, a term
+// ending with * for words with that prefix. Terms without an operator in between are combined
+// with AND.
+type Query struct {
+	text string
+	root queryNode
+}
+
+type queryNode interface {
+	expression() exp.Expression
+	matches(log map[string]any) bool
+	messagePatterns() []*regexp.Regexp
+}
+
+func (q *Query) String() string {
+	return q.text
+}
+
+func (q *Query) Expression() exp.Expression {
+	return q.root.expression()
+}
+
+func (q *Query) Matches(log map[string]any) bool {
+	return q.root.matches(log)
+}
+
+// MessagePatterns returns the patterns of the message searches for highlighting them. Negated
+// searches are left out.
+func (q *Query) MessagePatterns() []*regexp.Regexp {
+	return q.root.messagePatterns()
+}
+
+// ParseQuery returns nil if the query is empty.
+func ParseQuery(text string) (*Query, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	parser := &queryParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.position < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected %q", parser.tokens[parser.position].text)
+	}
+	return &Query{text: text, root: root}, nil
+}
+
+type queryTokenKind int
+
+const (
+	wordToken queryTokenKind = iota
+	quotedToken
+	operatorToken
+	openToken
+	closeToken
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+}
+
+var queryOperators = []string{"<=", ">=", "!=", ":", "=", "~", "<", ">"}
+
+func tokenizeQuery(text string) ([]queryToken, error) {
+	tokens := make([]queryToken, 0)
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: openToken, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: closeToken, text: ")"})
+			i++
+		case r == '"':
+			var builder strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				builder.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("missing closing quote")
+			}
+			i++
+			tokens = append(tokens, queryToken{kind: quotedToken, text: builder.String()})
+		default:
+			if operator := operatorAt(runes, i); operator != "" {
+				tokens = append(tokens, queryToken{kind: operatorToken, text: operator})
+				i += len(operator)
+				continue
+			}
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()"`, runes[i]) && operatorAt(runes, i) == "" {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: wordToken, text: string(runes[start:i])})
+		}
+	}
+	return tokens, nil
+}
+
+func operatorAt(runes []rune, i int) string {
+	for _, operator := range queryOperators {
+		if strings.HasPrefix(string(runes[i:min(i+2, len(runes))]), operator) {
+			return operator
+		}
+	}
+	return ""
+}
+
+type queryParser struct {
+	tokens   []queryToken
+	position int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.position >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.position]
+}
+
+func (p *queryParser) isKeyword(keyword string) bool {
+	token := p.peek()
+	return token != nil && token.kind == wordToken && token.text == keyword
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []queryNode{left}
+	for p.isKeyword("OR") {
+		p.position++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, right)
+	}
+	if len(nodes) == 1 {
+		return left, nil
+	}
+	return orNode(nodes), nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []queryNode{left}
+	for {
+		token := p.peek()
+		if token == nil || token.kind == closeToken || p.isKeyword("OR") {
+			break
+		}
+		if p.isKeyword("AND") {
+			p.position++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, right)
+	}
+	if len(nodes) == 1 {
+		return left, nil
+	}
+	return andNode(nodes), nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	token := p.peek()
+	if token == nil {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	switch {
+	case p.isKeyword("NOT"):
+		p.position++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node: node}, nil
+	case token.kind == openToken:
+		p.position++
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		closing := p.peek()
+		if closing == nil || closing.kind != closeToken {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.position++
+		return node, nil
+	case token.kind == wordToken || token.kind == quotedToken:
+		p.position++
+		operator := p.peek()
+		if token.kind == quotedToken || operator == nil || operator.kind != operatorToken {
+			if token.kind == wordToken && len(token.text) > 1 && strings.HasSuffix(token.text, "*") {
+				return newComparison(messageField, "prefix", strings.TrimSuffix(token.text, "*"))
+			}
+			return newComparison(messageField, "contains", token.text)
+		}
+		p.position++
+		value := p.peek()
+		if value == nil || (value.kind != wordToken && value.kind != quotedToken) {
+			return nil, fmt.Errorf("missing value after %v%v", token.text, operator.text)
+		}
+		p.position++
+		if value.kind == quotedToken && operator.text == ":" {
+			return newComparison(token.text, "=", value.text)
+		}
+		return newComparison(token.text, operator.text, value.text)
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+var queryFieldPattern = regexp.MustCompile(`^[A-Za-z0-9_.@-]+$`)
+
+func newComparison(field string, operator string, value string) (queryNode, error) {
+	if !queryFieldPattern.MatchString(field) {
+		return nil, fmt.Errorf("invalid field %q", field)
+	}
+	comparison := comparisonNode{field: field, operator: operator, value: value}
+	switch operator {
+	case ":":
+		if value == "*" {
+			comparison.operator = "exists"
+		} else if strings.Contains(value, "*") {
+			comparison.operator = "like"
+			comparison.pattern = regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(value), `\*`, ".*") + "$")
+		} else {
+			comparison.operator = "="
+		}
+	case "contains":
+		comparison.pattern = regexp.MustCompile("(?i)" + regexp.QuoteMeta(value))
+	case "prefix":
+		comparison.pattern = regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(value))
+	case "~":
+		if err := validateRegex(value); err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+		// . matches line breaks in Postgres as well
+		pattern, err := regexp.Compile("(?is)" + value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %w", value, err)
+		}
+		comparison.pattern = pattern
+	case "<", "<=", ">", ">=":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v%v%v needs a number", field, operator, value)
+		}
+		comparison.number = number
+	}
+	return comparison, nil
+}
+
+// regexEscapes are the escapes that mean the same in Go and Postgres. For example \b is a word
+// boundary in Go, but a backspace in Postgres, and \z or \pL only exist in Go.
+const regexEscapes = "afnrtvxdswDSWA"
+
+// validateRegex rejects the syntax that only Go supports or that Postgres interprets differently,
+// because the filter runs in Postgres and the live tail matches with Go. Groups with flags or
+// names like (?s) or (?P<name>) are rejected, only (?:) is allowed.
+func validateRegex(value string) error {
+	inClass := false
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if i+1 == len(value) {
+				return nil
+			}
+			i++
+			escaped := value[i]
+			isAlphanumeric := unicode.IsLetter(rune(escaped)) || unicode.IsDigit(rune(escaped))
+			if isAlphanumeric && !strings.ContainsRune(regexEscapes, rune(escaped)) {
+				return fmt.Errorf("\\%c is not supported", escaped)
+			}
+		case '[':
+			if !inClass {
+				inClass = true
+				// a ] right after the opening bracket is a literal
+				if strings.HasPrefix(value[i+1:], "^]") {
+					i += 2
+				} else if strings.HasPrefix(value[i+1:], "]") {
+					i++
+				}
+			}
+		case ']':
+			inClass = false
+		case '(':
+			if !inClass && strings.HasPrefix(value[i+1:], "?") && !strings.HasPrefix(value[i+1:], "?:") {
+				return fmt.Errorf("only (?:) groups are supported")
+			}
+		}
+	}
+	return nil
+}
+
+type comparisonNode struct {
+	field    string
+	operator string
+	value    string
+	number   float64
+	pattern  *regexp.Regexp
+}
+
+// numericPattern guards the cast, a cast of a text that is not a number would fail the query
+const numericPattern = `^\s*-?[0-9]+(\.[0-9]+)?\s*$`
+
+const messageField = "MESSAGE"
+
+// fieldExpression uses a constant for the MESSAGE, because the planner only uses the trigram
+// index on log->>'MESSAGE' for that exact expression and not for a parameter.
+func (n comparisonNode) fieldExpression() exp.LiteralExpression {
+	if n.field == messageField {
+		return goqu.L("log->>'MESSAGE'")
+	}
+	return goqu.L("log->>?", n.field)
+}
+
+func (n comparisonNode) expression() exp.Expression {
+	field := n.fieldExpression()
+	switch n.operator {
+	case "exists":
+		return field.IsNotNull()
+	case "like":
+		return field.Like(strings.ReplaceAll(escapeLike(n.value), "*", "%"))
+	case "=":
+		return field.Eq(n.value)
+	case "!=":
+		// logs without the field are not equal as well
+		return goqu.Or(field.IsNull(), field.Neq(n.value))
+	case "contains":
+		return field.ILike("%" + escapeLike(n.value) + "%")
+	case "prefix":
+		// \m is the beginning of a word in Postgres regular expressions
+		return goqu.L("? ~* ?", field, `\m`+regexp.QuoteMeta(n.value))
+	case "~":
+		return goqu.L("? ~* ?", field, n.value)
+	}
+	sqlOperator := n.operator
+	return goqu.L(fmt.Sprintf("(case when log->>? ~ ? then (log->>?)::numeric end) %v ?", sqlOperator), n.field, numericPattern, n.field, n.number)
+}
+
+func (n comparisonNode) matches(log map[string]any) bool {
+	rawValue, exists := log[n.field]
+	if !exists || rawValue == nil {
+		return n.operator == "!="
+	}
+	value := fmt.Sprint(rawValue)
+	if text, ok := rawValue.(string); ok {
+		value = text
+	}
+	switch n.operator {
+	case "exists":
+		return true
+	case "like", "contains", "prefix", "~":
+		return n.pattern.MatchString(value)
+	case "=":
+		return value == n.value
+	case "!=":
+		return value != n.value
+	}
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return false
+	}
+	switch n.operator {
+	case "<":
+		return number < n.number
+	case "<=":
+		return number <= n.number
+	case ">":
+		return number > n.number
+	default:
+		return number >= n.number
+	}
+}
+
+func (n comparisonNode) messagePatterns() []*regexp.Regexp {
+	if n.field != messageField {
+		return nil
+	}
+	switch n.operator {
+	case "contains", "prefix", "~":
+		return []*regexp.Regexp{n.pattern}
+	}
+	return nil
+}
+
+type andNode []queryNode
+
+func (n andNode) expression() exp.Expression {
+	and := goqu.And()
+	for _, node := range n {
+		and = and.Append(node.expression())
+	}
+	return and
+}
+
+func (n andNode) matches(log map[string]any) bool {
+	for _, node := range n {
+		if !node.matches(log) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n andNode) messagePatterns() []*regexp.Regexp {
+	return collectMessagePatterns(n)
+}
+
+type orNode []queryNode
+
+func (n orNode) expression() exp.Expression {
+	or := goqu.Or()
+	for _, node := range n {
+		or = or.Append(node.expression())
+	}
+	return or
+}
+
+func (n orNode) matches(log map[string]any) bool {
+	for _, node := range n {
+		if node.matches(log) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n orNode) messagePatterns() []*regexp.Regexp {
+	return collectMessagePatterns(n)
+}
+
+func collectMessagePatterns(nodes []queryNode) []*regexp.Regexp {
+	patterns := make([]*regexp.Regexp, 0)
+	for _, node := range nodes {
+		patterns = append(patterns, node.messagePatterns()...)
+	}
+	return patterns
+}
+
+type notNode struct {
+	node queryNode
+}
+
+func (n notNode) expression() exp.Expression {
+	return goqu.L("NOT (?)", n.node.expression())
+}
+
+func (n notNode) matches(log map[string]any) bool {
+	return !n.node.matches(log)
+}
+
+func (n notNode) messagePatterns() []*regexp.Regexp {
+	return nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
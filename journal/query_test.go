@@ -0,0 +1,157 @@
+package journal
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	nginxError := map[string]any{
+		"PRIORITY":      "3",
+		"_SYSTEMD_UNIT": "nginx.service",
+		"MESSAGE":       "upstream timed out",
+	}
+	nginxHealth := map[string]any{
+		"PRIORITY":      "3",
+		"_SYSTEMD_UNIT": "nginx.service",
+		"MESSAGE":       "GET /Health failed",
+	}
+	dockerInfo := map[string]any{
+		"PRIORITY":      "6",
+		"_SYSTEMD_UNIT": "docker.service",
+		"MESSAGE":       "container started",
+	}
+
+	t.Run("should match the example query", func(t *testing.T) {
+		// arrange
+		query, err := ParseQuery(`PRIORITY<=3 AND _SYSTEMD_UNIT:nginx* AND NOT MESSAGE~"health"`)
+		assert.NoError(t, err)
+
+		// act & assert
+		assert.True(t, query.Matches(nginxError))
+		assert.False(t, query.Matches(nginxHealth))
+		assert.False(t, query.Matches(dockerInfo))
+	})
+
+	t.Run("should combine terms with OR and parentheses", func(t *testing.T) {
+		// arrange
+		query, err := ParseQuery(`(_SYSTEMD_UNIT=docker.service OR PRIORITY<3) started`)
+		assert.NoError(t, err)
+
+		// act & assert
+		assert.True(t, query.Matches(dockerInfo))
+		assert.False(t, query.Matches(nginxError))
+	})
+
+	t.Run("should check if a field exists and compare unequal", func(t *testing.T) {
+		// arrange
+		exists, err := ParseQuery(`CONTAINER_NAME:*`)
+		assert.NoError(t, err)
+		notEqual, err := ParseQuery(`CONTAINER_NAME!=gitlab-runner`)
+		assert.NoError(t, err)
+
+		// act & assert
+		assert.False(t, exists.Matches(dockerInfo))
+		assert.True(t, exists.Matches(map[string]any{"CONTAINER_NAME": "gitlab-runner"}))
+		assert.True(t, notEqual.Matches(dockerInfo))
+		assert.False(t, notEqual.Matches(map[string]any{"CONTAINER_NAME": "gitlab-runner"}))
+	})
+
+	t.Run("should return nil for an empty query", func(t *testing.T) {
+		// act
+		query, err := ParseQuery("  ")
+
+		// assert
+		assert.NoError(t, err)
+		assert.Nil(t, query)
+	})
+
+	t.Run("should reject invalid queries", func(t *testing.T) {
+		invalid := []string{
+			`PRIORITY<=abc`,
+			`MESSAGE~"("`,
+			`(PRIORITY:3`,
+			`MESSAGE:"unterminated`,
+			`PRIORITY:3 AND`,
+			`PRIORITY:`,
+			`"a'b"=c`,
+		}
+		for _, text := range invalid {
+			_, err := ParseQuery(text)
+			assert.Error(t, err, text)
+		}
+	})
+
+	t.Run("should compile to a parameterized expression", func(t *testing.T) {
+		// arrange
+		query, err := ParseQuery(`PRIORITY<=3 AND _SYSTEMD_UNIT:nginx_* AND NOT MESSAGE~"'; drop table logs"`)
+		assert.NoError(t, err)
+
+		// act
+		sql, args, err := goqu.Dialect("postgres").From("logs").Prepared(true).Where(query.Expression()).ToSQL()
+
+		// assert
+		assert.NoError(t, err)
+		assert.NotContains(t, sql, "drop table")
+		assert.NotContains(t, sql, "nginx")
+		assert.Contains(t, args, `nginx\_%`)
+		assert.Contains(t, args, `'; drop table logs`)
+	})
+
+	t.Run("should search the message with the indexed expression", func(t *testing.T) {
+		// arrange
+		query, err := ParseQuery(`time* "connection refused" 100%`)
+		assert.NoError(t, err)
+
+		// act
+		sql, args, err := goqu.Dialect("postgres").From("logs").Prepared(true).Where(query.Expression()).ToSQL()
+
+		// assert
+		assert.NoError(t, err)
+		assert.Contains(t, sql, `log->>'MESSAGE' ~* $1`)
+		assert.Contains(t, sql, `log->>'MESSAGE' ILIKE $2`)
+		assert.Equal(t, []any{`\mtime`, "%connection refused%", `%100\%%`}, args)
+		assert.True(t, query.Matches(map[string]any{"MESSAGE": "Timeout, connection refused at 100%"}))
+		assert.False(t, query.Matches(map[string]any{"MESSAGE": "uptime, connection refused at 100%"}))
+	})
+
+	t.Run("should reject the regular expression syntax that Postgres does not share", func(t *testing.T) {
+		invalid := []string{
+			`MESSAGE~"(?P<n>timeout)"`,
+			`MESSAGE~"(?<n>timeout)"`,
+			`MESSAGE~"(?s)a.b"`,
+			`MESSAGE~"timeout\\z"`,
+			`MESSAGE~"\\btimeout"`,
+			`MESSAGE~"\\pL+"`,
+			`MESSAGE~"(a)\\1"`,
+		}
+		for _, text := range invalid {
+			_, err := ParseQuery(text)
+			assert.Error(t, err, text)
+		}
+	})
+
+	t.Run("should accept the common regular expression syntax", func(t *testing.T) {
+		valid := []string{
+			`MESSAGE~"^(?:GET|POST) /api/\\d+$"`,
+			`MESSAGE~"[(?]\\s*\\w+"`,
+			`MESSAGE~"[]a]\\.b"`,
+			`MESSAGE~"\\(?timeout"`,
+		}
+		for _, text := range valid {
+			_, err := ParseQuery(text)
+			assert.NoError(t, err, text)
+		}
+	})
+
+	t.Run("should match line breaks with a dot like Postgres", func(t *testing.T) {
+		// arrange
+		query, err := ParseQuery(`MESSAGE~"first.second"`)
+		assert.NoError(t, err)
+
+		// assert
+		assert.True(t, query.Matches(map[string]any{"MESSAGE": "first\nsecond"}))
+	})
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"github.com/gorlug/metrics-backend/apikey"
+	"github.com/gorlug/metrics-backend/ingest"
 	"github.com/gorlug/metrics-backend/journal"
 	"github.com/gorlug/metrics-backend/metrics"
 	"github.com/gorlug/metrics-backend/rest"
@@ -10,6 +12,8 @@ import (
 	"github.com/robfig/cron"
 	"log"
 	"os"
+	"strconv"
+	"time"
 	_ "time/tzdata"
 )
 
@@ -28,6 +32,8 @@ func main() {
 	metricsService, err := metrics.NewDBMetricsService(os.Getenv("DATABASE_URL"), telegramAlerter)
 	CheckError(err)
 	defer metricsService.Close()
+	metricsService.MaxFutureSkew, err = time.ParseDuration(getEnvWithDefault("MAX_FUTURE_SKEW", metrics.DefaultMaxFutureSkew.String()))
+	CheckError(err)
 
 	var journalService *journal.JournalLogService
 	timescaleDbUrl := os.Getenv("TIMESCALE_DATABASE_URL")
@@ -39,6 +45,8 @@ func main() {
 			log.Print("Journal service is enabled")
 		}
 		CheckError(err)
+		logService.StripAnsi, err = strconv.ParseBool(getEnvWithDefault("JOURNAL_STRIP_ANSI", "false"))
+		CheckError(err)
 		journalService = logService
 		defer logService.Close()
 	}
@@ -46,7 +54,13 @@ func main() {
 	userService, err := user.NewUserService(metricsService.ConnPool)
 	CheckError(err)
 
-	alertChecker := metrics.NewAlertChecker(metricsService, telegramAlerter)
+	apiKeyService, err := apikey.NewApiKeyService(metricsService.ConnPool)
+	CheckError(err)
+
+	err = metricsService.LoadExpectedMetrics(os.Getenv("EXPECTED_METRICS_FILE"))
+	CheckError(err)
+
+	alertChecker := metrics.NewAlertChecker(metricsService, telegramAlerter).WithExpectedMetrics(metricsService)
 	alertChecker.CheckAlerts()
 
 	cronSpec := cron.New()
@@ -56,10 +70,52 @@ func main() {
 	}
 	err = cronSpec.AddFunc(fmt.Sprintf("@every %v", interval), alertChecker.CheckAlerts)
 	CheckError(err)
+
+	retirementPolicy, err := metrics.LoadRetirementPolicy(os.Getenv("RETIREMENT_RULES_FILE"))
+	CheckError(err)
+	if retirementPolicy != nil {
+		retirer := metrics.NewMetricRetirer(metricsService, retirementPolicy, telegramAlerter)
+		err = cronSpec.AddFunc(fmt.Sprintf("@every %v", getEnvWithDefault("RETIREMENT_INTERVAL", "1h")), retirer.RetireMetrics)
+		CheckError(err)
+	}
+	var retentionPolicy *journal.RetentionPolicy
+	if journalService != nil {
+		retentionPolicy, err = journal.LoadRetentionPolicy(os.Getenv("JOURNAL_RETENTION_RULES_FILE"))
+		CheckError(err)
+		retainer := journal.NewLogRetainer(journalService, retentionPolicy)
+		err = cronSpec.AddFunc(fmt.Sprintf("@every %v", getEnvWithDefault("JOURNAL_RETENTION_INTERVAL", "1h")), retainer.DeleteExpiredLogs)
+		CheckError(err)
+	}
 	cronSpec.Start()
 	defer cronSpec.Stop()
 
-	rest.CreateRestApi(metricsService, journalService, userService)
+	logAlertRules, err := journal.LoadLogAlertRules(os.Getenv("LOG_ALERT_RULES_FILE"))
+	CheckError(err)
+	if journalService != nil && logAlertRules != nil {
+		logAlerter := journal.NewLogAlerter(logAlertRules, telegramAlerter)
+		logAlerter.Start()
+		journalService.AddLogsListener(logAlerter)
+	}
+
+	statsdAddress := os.Getenv("STATSD_ADDRESS")
+	if statsdAddress != "" {
+		flushInterval, err := time.ParseDuration(getEnvWithDefault("STATSD_FLUSH_INTERVAL", "10s"))
+		CheckError(err)
+		statsdListener, err := ingest.NewStatsdListener(statsdAddress, flushInterval, metricsService)
+		CheckError(err)
+		statsdListener.Start()
+		defer statsdListener.Close()
+	}
+
+	rest.CreateRestApi(metricsService, journalService, retentionPolicy, userService, apiKeyService)
+}
+
+func getEnvWithDefault(key string, defaultValue string) string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	return value
 }
 
 func CheckError(err error) {
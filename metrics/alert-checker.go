@@ -1,11 +1,24 @@
 package metrics
 
 import (
+	"github.com/gorlug/metrics-backend/stats"
 	"log"
+	"time"
+)
+
+var alertChecksTotal = stats.NewCounter("metrics_backend_alert_checks_total", "Number of alert checks that were run.")
+var alertCheckDurationSeconds = stats.NewGauge("metrics_backend_alert_check_duration_seconds", "Duration of the last alert check in seconds.")
+var alertsSentTotal = stats.NewCounter("metrics_backend_alerts_sent_total", "Number of alert messages that were sent.", "kind")
+var alertSendFailuresTotal = stats.NewCounter("metrics_backend_alert_send_failures_total", "Number of alert messages that failed to send.", "kind")
+
+const (
+	alertKind   = "alert"
+	okAgainKind = "ok_again"
 )
 
 type AlertChecker struct {
 	metricsService          MetricsService
+	expectedMetricsService  ExpectedMetricsService
 	alerter                 Alerter
 	MetricsServiceErrorSent bool
 }
@@ -14,8 +27,19 @@ func NewAlertChecker(metricsService MetricsService, alerter Alerter) *AlertCheck
 	return &AlertChecker{metricsService: metricsService, alerter: alerter, MetricsServiceErrorSent: false}
 }
 
+// WithExpectedMetrics enables alerts for expected metrics that were never reported.
+func (a *AlertChecker) WithExpectedMetrics(expectedMetricsService ExpectedMetricsService) *AlertChecker {
+	a.expectedMetricsService = expectedMetricsService
+	return a
+}
+
 func (a *AlertChecker) CheckAlerts() {
 	log.Println("Checking alerts")
+	start := time.Now()
+	defer func() {
+		alertChecksTotal.Inc()
+		alertCheckDurationSeconds.Set(time.Since(start).Seconds())
+	}()
 	metricsArr, err := a.metricsService.GetAllMetrics()
 	if err != nil {
 		a.sendFailedToGetMetrics(err)
@@ -26,40 +50,95 @@ func (a *AlertChecker) CheckAlerts() {
 	}
 	a.MetricsServiceErrorSent = false
 	for _, metric := range metricsArr {
+		if metric.GetMetricValues().State == Stale {
+			continue
+		}
 		log.Printf("Checking metric %v", metric.String())
 		if IsMetricInNewStateAlert(metric) {
 			log.Printf("setting alert for metric %v", metric.String())
-			updatedMetricValues, err := a.saveNewState(metric, Alert)
-			err = a.alerter.NewAlert(NewMetricBuilder().WithMetricValues(updatedMetricValues).Build())
-			if err != nil {
-				log.Println("Failed to send alert", err)
-			}
+			updatedMetricValues, _ := a.saveNewState(metric, Alert)
+			a.sendNewAlert(NewMetricBuilder().WithMetricValues(updatedMetricValues).Build())
 		}
 		if IsMetricOkAgain(metric) {
 			log.Printf("setting ok for metric %v", metric.String())
-			updatedMetricValues, err := a.saveNewState(metric, OK)
-			err = a.alerter.AlertOkAgain(NewMetricBuilder().WithMetricValues(updatedMetricValues).Build())
-			if err != nil {
-				log.Println("Failed to send alert", err)
-			}
+			updatedMetricValues, _ := a.saveNewState(metric, OK)
+			a.sendAlertOkAgain(NewMetricBuilder().WithMetricValues(updatedMetricValues).Build())
 		}
 	}
+	a.checkExpectedMetrics(metricsArr, time.Now())
 }
 
-func (a *AlertChecker) sendGettingMetricsOkAgain() {
-	err := a.alerter.AlertOkAgain(GetFailedToGetMetricsMetric())
+// checkExpectedMetrics alerts once for every expected metric that was not reported within its
+// grace period and sends ok again after the first report. A ping without a grace period is
+// missing after the minutes till alert of its value.
+func (a *AlertChecker) checkExpectedMetrics(metricsArr []Metric, now time.Time) {
+	if a.expectedMetricsService == nil {
+		return
+	}
+	expectedMetrics, err := a.expectedMetricsService.GetExpectedMetrics()
+	if err != nil {
+		log.Println("Failed to get expected metrics", err)
+		return
+	}
+	reported := map[string]bool{}
+	for _, metric := range metricsArr {
+		reported[metricKey(metric.GetMetricValues().Host, metric.GetMetricValues().Name)] = true
+	}
+	for _, expected := range expectedMetrics {
+		isReported := reported[metricKey(expected.Host, expected.Name)]
+		if !isReported && expected.State != Alert && expected.IsMissingSince(now) {
+			log.Printf("expected metric %v - %v was not reported within %v minutes", expected.Host, expected.Name, expected.graceMinutes())
+			a.saveExpectedMetricState(&expected, Alert)
+			a.sendNewAlert(expected.ToMetric())
+		}
+		if isReported && expected.State == Alert {
+			log.Printf("expected metric %v - %v was reported", expected.Host, expected.Name)
+			a.saveExpectedMetricState(&expected, OK)
+			a.sendAlertOkAgain(expected.ToMetric())
+		}
+	}
+}
+
+func (a *AlertChecker) saveExpectedMetricState(expected *ExpectedMetric, state MetricState) {
+	err := a.expectedMetricsService.SaveExpectedMetricState(*expected, state)
+	if err != nil {
+		log.Println("Failed to save expected metric", err)
+	}
+	expected.State = state
+}
+
+func metricKey(host string, name string) string {
+	return host + "\xff" + name
+}
+
+func (a *AlertChecker) sendNewAlert(metric Metric) {
+	err := a.alerter.NewAlert(metric)
+	if err != nil {
+		log.Println("Failed to send alert", err)
+		alertSendFailuresTotal.Inc(alertKind)
+		return
+	}
+	alertsSentTotal.Inc(alertKind)
+}
+
+func (a *AlertChecker) sendAlertOkAgain(metric Metric) {
+	err := a.alerter.AlertOkAgain(metric)
 	if err != nil {
 		log.Println("Failed to send alert", err)
+		alertSendFailuresTotal.Inc(okAgainKind)
+		return
 	}
+	alertsSentTotal.Inc(okAgainKind)
+}
+
+func (a *AlertChecker) sendGettingMetricsOkAgain() {
+	a.sendAlertOkAgain(GetFailedToGetMetricsMetric())
 }
 
 func (a *AlertChecker) sendFailedToGetMetrics(err error) {
 	log.Println("Failed to get metrics", err)
 	if !a.MetricsServiceErrorSent {
-		err := a.alerter.NewAlert(GetFailedToGetMetricsMetric())
-		if err != nil {
-			log.Println("Failed to send alert", err)
-		}
+		a.sendNewAlert(GetFailedToGetMetricsMetric())
 		a.MetricsServiceErrorSent = true
 	}
 }
@@ -3,6 +3,7 @@ package metrics
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func getAlertChecker(metrics []Metric, getAllMetricsError error) (*AlertChecker, *MockMetricsService, *MockAlerter) {
@@ -32,6 +33,21 @@ func TestAlertChecker(t *testing.T) {
 		assert.Equal(t, 0, len(alerter.alertsOkAgain))
 	})
 
+	t.Run("should not check stale metrics", func(t *testing.T) {
+		// arrange
+		alertChecker, service, alerter := getAlertChecker([]Metric{
+			&MockMetric{
+				NextState:    Alert,
+				MetricValues: MetricValues{Host: "host1", Name: "some metric", Type: Ping, State: Stale},
+			},
+		}, nil)
+		// act
+		alertChecker.CheckAlerts()
+		// assert
+		assert.Equal(t, 0, len(service.stateSaved))
+		assert.Equal(t, 0, len(alerter.newAlerts))
+	})
+
 	t.Run("should not create a new alert if the next state is not alert", func(t *testing.T) {
 		// arrange
 		alertChecker, service, alerter := getAlertChecker([]Metric{
@@ -159,3 +175,101 @@ func (m *MockAlerter) AlertOkAgain(metric Metric) error {
 	m.alertsOkAgain = append(m.alertsOkAgain, metric)
 	return nil
 }
+
+type MockExpectedMetricsService struct {
+	expectedMetrics []ExpectedMetric
+	stateSaved      []ExpectedMetric
+}
+
+func (m *MockExpectedMetricsService) GetExpectedMetrics() ([]ExpectedMetric, error) {
+	return m.expectedMetrics, nil
+}
+
+func (m *MockExpectedMetricsService) SaveExpectedMetricState(expected ExpectedMetric, state MetricState) error {
+	expected.State = state
+	m.stateSaved = append(m.stateSaved, expected)
+	return nil
+}
+
+func TestAlertCheckerExpectedMetrics(t *testing.T) {
+	now := time.Now()
+	reportedMetric := &MockMetric{NextState: OK, MetricValues: MetricValues{Host: "host1", Name: "reported", Type: Ping, State: OK}}
+
+	t.Run("should alert once for expected metrics that were never reported after the grace period", func(t *testing.T) {
+		// arrange
+		alertChecker, _, alerter := getAlertChecker([]Metric{reportedMetric}, nil)
+		expectedService := &MockExpectedMetricsService{expectedMetrics: []ExpectedMetric{
+			{Host: "host1", Name: "missing", Type: Ping, State: OK, CreatedAt: now.Add(-2 * time.Hour)},
+			{Host: "host1", Name: "already alerted", Type: Ping, State: Alert, CreatedAt: now.Add(-2 * time.Hour)},
+			{Host: "host1", Name: "in grace period", Type: Ping, State: OK, GraceMinutes: 180, CreatedAt: now.Add(-2 * time.Hour)},
+			{Host: "host1", Name: "reported", Type: Ping, State: OK, CreatedAt: now.Add(-2 * time.Hour)},
+		}}
+		alertChecker.WithExpectedMetrics(expectedService)
+
+		// act
+		alertChecker.CheckAlerts()
+
+		// assert
+		assert.Equal(t, 1, len(expectedService.stateSaved))
+		assert.Equal(t, "missing", expectedService.stateSaved[0].Name)
+		assert.Equal(t, Alert, expectedService.stateSaved[0].State)
+		assert.Equal(t, 1, len(alerter.newAlerts))
+		assert.EqualValues(t, MetricValues{Host: "host1", Name: "missing", Type: Ping, State: Alert, Value: "never reported"}, alerter.newAlerts[0].GetMetricValues())
+	})
+
+	t.Run("should send ok again once the expected metric is reported", func(t *testing.T) {
+		// arrange
+		alertChecker, _, alerter := getAlertChecker([]Metric{reportedMetric}, nil)
+		expectedService := &MockExpectedMetricsService{expectedMetrics: []ExpectedMetric{
+			{Host: "host1", Name: "reported", Type: Ping, State: Alert, CreatedAt: now.Add(-2 * time.Hour)},
+		}}
+		alertChecker.WithExpectedMetrics(expectedService)
+
+		// act
+		alertChecker.CheckAlerts()
+
+		// assert
+		assert.Equal(t, OK, expectedService.stateSaved[0].State)
+		assert.Equal(t, 0, len(alerter.newAlerts))
+		assert.Equal(t, 1, len(alerter.alertsOkAgain))
+	})
+}
+
+func TestAlertCheckerExpectedMetricsWithValue(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should use the minutes till alert of a ping as grace period", func(t *testing.T) {
+		// arrange
+		alertChecker, _, alerter := getAlertChecker([]Metric{}, nil)
+		expectedService := &MockExpectedMetricsService{expectedMetrics: []ExpectedMetric{
+			{Host: "host1", Name: "overdue", Type: Ping, Value: "10", State: OK, CreatedAt: now.Add(-15 * time.Minute)},
+			{Host: "host1", Name: "not yet overdue", Type: Ping, Value: "30", State: OK, CreatedAt: now.Add(-15 * time.Minute)},
+			{Host: "host1", Name: "grace minutes win", Type: Ping, Value: "10", GraceMinutes: 60, State: OK, CreatedAt: now.Add(-15 * time.Minute)},
+		}}
+		alertChecker.WithExpectedMetrics(expectedService)
+
+		// act
+		alertChecker.CheckAlerts()
+
+		// assert
+		assert.Equal(t, 1, len(alerter.newAlerts))
+		assert.Equal(t, "overdue", alerter.newAlerts[0].GetMetricValues().Name)
+	})
+
+	t.Run("should send ok again with the configured value", func(t *testing.T) {
+		// arrange
+		reportedMetric := &MockMetric{NextState: OK, MetricValues: MetricValues{Host: "host1", Name: "/", Type: Disk, Value: "50", State: OK}}
+		alertChecker, _, alerter := getAlertChecker([]Metric{reportedMetric}, nil)
+		expectedService := &MockExpectedMetricsService{expectedMetrics: []ExpectedMetric{
+			{Host: "host1", Name: "/", Type: Disk, Value: "90", State: Alert, CreatedAt: now.Add(-2 * time.Hour)},
+		}}
+		alertChecker.WithExpectedMetrics(expectedService)
+
+		// act
+		alertChecker.CheckAlerts()
+
+		// assert
+		assert.Equal(t, 1, len(alerter.alertsOkAgain))
+		assert.EqualValues(t, MetricValues{Host: "host1", Name: "/", Type: Disk, State: OK, Value: "90"}, alerter.alertsOkAgain[0].GetMetricValues())
+	})
+}
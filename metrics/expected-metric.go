@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const defaultGraceMinutes = 60
+
+// ExpectedMetric is registered before its first report. If it is not reported within the grace
+// period after the registration, the AlertChecker sends an alert. Value is the alert config the
+// metric is expected with, e.g. the minutes till alert of a ping.
+type ExpectedMetric struct {
+	Id           int         `json:"id,omitempty"`
+	Host         string      `json:"host"`
+	Name         string      `json:"name"`
+	Type         MetricType  `json:"type"`
+	GraceMinutes int         `json:"graceMinutes,omitempty"`
+	Value        string      `json:"value,omitempty"`
+	State        MetricState `json:"state,omitempty"`
+	CreatedAt    time.Time   `json:"createdAt"`
+}
+
+// Validate does not require a value, because an expected metric has not been reported yet.
+func (e ExpectedMetric) Validate() []string {
+	problems := make([]string, 0)
+	problems = append(problems, validateRequiredField("host", e.Host)...)
+	problems = append(problems, validateRequiredField("name", e.Name)...)
+	if e.Type == "" {
+		problems = append(problems, "type is required")
+	} else if !IsValidMetricType(string(e.Type)) {
+		problems = append(problems, fmt.Sprintf("type %q is invalid", e.Type))
+	}
+	if e.Value != "" {
+		problems = append(problems, MetricValues{Type: e.Type, Value: e.Value}.validateValue()...)
+	}
+	if e.GraceMinutes < 0 {
+		problems = append(problems, "graceMinutes must not be negative")
+	}
+	return problems
+}
+
+func (e ExpectedMetric) IsMissingSince(now time.Time) bool {
+	return now.Sub(e.CreatedAt) >= time.Duration(e.graceMinutes())*time.Minute
+}
+
+// graceMinutes defaults to the minutes till alert of a ping, because the ping is overdue after
+// them anyway.
+func (e ExpectedMetric) graceMinutes() int {
+	if e.GraceMinutes > 0 {
+		return e.GraceMinutes
+	}
+	if e.Type == Ping {
+		if minutes, err := strconv.Atoi(e.Value); err == nil && minutes > 0 {
+			return minutes
+		}
+	}
+	return defaultGraceMinutes
+}
+
+// ToMetric is used for the alert messages.
+func (e ExpectedMetric) ToMetric() Metric {
+	metricValues := MetricValues{Host: e.Host, Name: e.Name, Type: e.Type, State: e.State, Value: e.Value}
+	if e.State == Alert {
+		metricValues.Value = "never reported"
+	}
+	return NewMetricBuilder().WithMetricValues(metricValues).Build()
+}
+
+type ExpectedMetricsService interface {
+	GetExpectedMetrics() ([]ExpectedMetric, error)
+	SaveExpectedMetricState(expected ExpectedMetric, state MetricState) error
+}
+
+// SaveExpectedMetric inserts the expected metric or updates the type, grace period and value. The
+// registration time is kept, so that the grace period does not restart.
+func (s *DbMetricsService) SaveExpectedMetric(expected ExpectedMetric) (ExpectedMetric, error) {
+	row := s.ConnPool.QueryRow(context.Background(), `
+insert into "expected_metric" ("host", "name", "type", "grace_minutes", "value")
+values ($1, $2, $3, $4, $5)
+on conflict ("host", "name") do update
+    set type          = $3,
+        grace_minutes = $4,
+        value         = $5
+returning id, host, name, type, grace_minutes, value, state, created_at
+`, expected.Host, expected.Name, expected.Type, expected.GraceMinutes, expected.Value)
+	return scanExpectedMetric(row.Scan)
+}
+
+func (s *DbMetricsService) GetExpectedMetrics() ([]ExpectedMetric, error) {
+	rows, err := s.ConnPool.Query(context.Background(), `select id, host, name, type, grace_minutes, value, state, created_at from expected_metric
+order by host, name
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expectedMetrics := make([]ExpectedMetric, 0)
+	for rows.Next() {
+		expected, err := scanExpectedMetric(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		expectedMetrics = append(expectedMetrics, expected)
+	}
+	return expectedMetrics, rows.Err()
+}
+
+func scanExpectedMetric(scan func(dest ...any) error) (ExpectedMetric, error) {
+	var expected ExpectedMetric
+	err := scan(&expected.Id, &expected.Host, &expected.Name, &expected.Type, &expected.GraceMinutes, &expected.Value, &expected.State, &expected.CreatedAt)
+	return expected, err
+}
+
+func (s *DbMetricsService) SaveExpectedMetricState(expected ExpectedMetric, state MetricState) error {
+	_, err := s.ConnPool.Exec(context.Background(), `update "expected_metric" set state = $1 where id = $2`, state, expected.Id)
+	return err
+}
+
+func (s *DbMetricsService) DeleteExpectedMetric(id int) error {
+	_, err := s.ConnPool.Exec(context.Background(), `delete from "expected_metric" where id = $1`, id)
+	return err
+}
+
+// LoadExpectedMetrics saves the expected metrics of the JSON file. Expected metrics that were
+// created via the API are kept.
+func (s *DbMetricsService) LoadExpectedMetrics(file string) error {
+	if file == "" {
+		return nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var expectedMetrics []ExpectedMetric
+	err = json.Unmarshal(content, &expectedMetrics)
+	if err != nil {
+		return fmt.Errorf("failed to parse %v: %w", file, err)
+	}
+	for _, expected := range expectedMetrics {
+		if problems := expected.Validate(); len(problems) > 0 {
+			return fmt.Errorf("invalid expected metric %v - %v: %v", expected.Host, expected.Name, problems)
+		}
+		_, err = s.SaveExpectedMetric(expected)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
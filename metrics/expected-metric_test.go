@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExpectedMetricValidate(t *testing.T) {
+	t.Run("should accept disk and gauge metrics without a value", func(t *testing.T) {
+		for _, metricType := range []MetricType{Disk, Gauge} {
+			expected := ExpectedMetric{Host: "host1", Name: "/", Type: metricType}
+			assert.Empty(t, expected.Validate(), metricType)
+		}
+	})
+
+	t.Run("should validate the configured value", func(t *testing.T) {
+		assert.Empty(t, ExpectedMetric{Host: "host1", Name: "/", Type: Disk, Value: "90"}.Validate())
+		assert.Equal(t, []string{`value "full" of a disk metric must be a number`},
+			ExpectedMetric{Host: "host1", Name: "/", Type: Disk, Value: "full"}.Validate())
+		assert.Equal(t, []string{`value "0" of a ping metric must be a positive number of minutes`},
+			ExpectedMetric{Host: "host1", Name: "backup", Type: Ping, Value: "0"}.Validate())
+	})
+
+	t.Run("should list every problem", func(t *testing.T) {
+		expected := ExpectedMetric{Host: " ", Type: "cpu", GraceMinutes: -1}
+		assert.Equal(t, []string{
+			"host is required",
+			"name is required",
+			`type "cpu" is invalid`,
+			"graceMinutes must not be negative",
+		}, expected.Validate())
+	})
+}
@@ -0,0 +1,15 @@
+package metrics
+
+// GaugeMetric carries a numeric value that is only collected, e.g. from Prometheus or Telegraf.
+// It never turns into an alert by itself.
+type GaugeMetric struct {
+	MetricValues
+}
+
+func (m *GaugeMetric) GetNextState() MetricState {
+	return OK
+}
+
+func (m *GaugeMetric) GetMetricValues() MetricValues {
+	return m.MetricValues
+}
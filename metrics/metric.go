@@ -1,20 +1,24 @@
 package metrics
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type MetricType string
 
 const (
-	Disk MetricType = "disk"
-	Ping MetricType = "ping"
+	Disk  MetricType = "disk"
+	Ping  MetricType = "ping"
+	Gauge MetricType = "gauge"
 )
 
 func IsValidMetricType(metricType string) bool {
-	for _, t := range []MetricType{Disk, Ping} {
+	for _, t := range []MetricType{Disk, Ping, Gauge} {
 		if MetricType(metricType) == t {
 			return true
 		}
@@ -27,10 +31,12 @@ type MetricState string
 const (
 	OK    MetricState = "ok"
 	Alert MetricState = "alert"
+	// Stale metrics were not reported for a while and are not checked for alerts anymore
+	Stale MetricState = "stale"
 )
 
 func IsValidMetricState(metricState string) bool {
-	for _, s := range []MetricState{OK, Alert} {
+	for _, s := range []MetricState{OK, Alert, Stale} {
 		if MetricState(metricState) == s {
 			return true
 		}
@@ -44,9 +50,83 @@ type MetricValues struct {
 	Type      MetricType `json:"type"`
 	Timestamp time.Time  `json:"timestamp"`
 	// optional
-	Value string      `json:"value,omitempty"`
-	State MetricState `json:"state,omitempty"`
-	Id    int
+	Value  string            `json:"value,omitempty"`
+	State  MetricState       `json:"state,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Id     int               `json:"id,omitempty"`
+}
+
+const maxFieldLength = 255
+const maxLabels = 32
+
+// Validate checks the values a client sent and returns a description of every problem found.
+func (m MetricValues) Validate() []string {
+	problems := make([]string, 0)
+	problems = append(problems, validateRequiredField("host", m.Host)...)
+	problems = append(problems, validateRequiredField("name", m.Name)...)
+	if m.Type == "" {
+		problems = append(problems, "type is required")
+	} else if !IsValidMetricType(string(m.Type)) {
+		problems = append(problems, fmt.Sprintf("type %q is invalid", m.Type))
+	}
+	if m.State != "" && !IsValidMetricState(string(m.State)) {
+		problems = append(problems, fmt.Sprintf("state %q is invalid", m.State))
+	}
+	problems = append(problems, m.validateValue()...)
+	problems = append(problems, m.validateLabels()...)
+	return problems
+}
+
+func validateRequiredField(field string, value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return []string{fmt.Sprintf("%v is required", field)}
+	}
+	if len(value) > maxFieldLength {
+		return []string{fmt.Sprintf("%v must not be longer than %v characters", field, maxFieldLength)}
+	}
+	return nil
+}
+
+func (m MetricValues) validateLabels() []string {
+	if len(m.Labels) > maxLabels {
+		return []string{fmt.Sprintf("a metric must not have more than %v labels", maxLabels)}
+	}
+	problems := make([]string, 0)
+	for _, key := range sortedKeys(m.Labels) {
+		if strings.TrimSpace(key) == "" {
+			problems = append(problems, "label names must not be empty")
+		} else if len(key) > maxFieldLength || len(m.Labels[key]) > maxFieldLength {
+			problems = append(problems, fmt.Sprintf("label %q must not be longer than %v characters", key, maxFieldLength))
+		}
+	}
+	return problems
+}
+
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m MetricValues) validateValue() []string {
+	switch m.Type {
+	case Disk, Gauge:
+		if _, err := strconv.ParseFloat(m.Value, 64); err != nil {
+			return []string{fmt.Sprintf("value %q of a %v metric must be a number", m.Value, m.Type)}
+		}
+	case Ping:
+		if m.Value == "" {
+			return nil
+		}
+		minutes, err := strconv.Atoi(m.Value)
+		if err != nil || minutes <= 0 {
+			return []string{fmt.Sprintf("value %q of a ping metric must be a positive number of minutes", m.Value)}
+		}
+	}
+	return nil
 }
 
 type Metric interface {
@@ -57,6 +137,7 @@ type Metric interface {
 
 type MetricBuilder struct {
 	MetricValues
+	errors []error
 }
 
 func NewMetricBuilder() *MetricBuilder {
@@ -75,7 +156,8 @@ func (m *MetricBuilder) WithName(name string) *MetricBuilder {
 
 func (m *MetricBuilder) WithType(metricType MetricType) *MetricBuilder {
 	if !IsValidMetricType(string(metricType)) {
-		log.Fatalf("Invalid metric type: %v", metricType)
+		m.errors = append(m.errors, fmt.Errorf("invalid metric type: %v", metricType))
+		return m
 	}
 	m.Type = metricType
 	return m
@@ -93,7 +175,8 @@ func (m *MetricBuilder) WithValue(value string) *MetricBuilder {
 
 func (m *MetricBuilder) WithState(state MetricState) *MetricBuilder {
 	if !IsValidMetricState(string(state)) {
-		log.Fatalf("Invalid metric state: %v", state)
+		m.errors = append(m.errors, fmt.Errorf("invalid metric state: %v", state))
+		return m
 	}
 	m.State = state
 	return m
@@ -104,6 +187,11 @@ func (m *MetricBuilder) WithMetricValues(metricValues MetricValues) *MetricBuild
 	return m
 }
 
+// Err returns the invalid values that were passed to the builder. These values are ignored by the builder.
+func (m *MetricBuilder) Err() error {
+	return errors.Join(m.errors...)
+}
+
 func (m *MetricBuilder) Build() Metric {
 	if m.State == "" {
 		m.WithState(OK)
@@ -113,6 +201,10 @@ func (m *MetricBuilder) Build() Metric {
 		return &DiskMetric{
 			MetricValues: m.MetricValues,
 		}
+	case Gauge:
+		return &GaugeMetric{
+			MetricValues: m.MetricValues,
+		}
 	default:
 		return &PingMetric{
 			MetricValues: m.MetricValues,
@@ -121,7 +213,7 @@ func (m *MetricBuilder) Build() Metric {
 }
 
 func (m MetricValues) String() string {
-	return fmt.Sprintf("Metric{Host: %v, Name: %v, Type: %v, Timestamp: %v, Value: %v, State: %v}", m.Host, m.Name, m.Type, m.Timestamp, m.Value, m.State)
+	return fmt.Sprintf("Metric{Host: %v, Name: %v, Type: %v, Timestamp: %v, Value: %v, State: %v, Labels: %v}", m.Host, m.Name, m.Type, m.Timestamp, m.Value, m.State, m.Labels)
 }
 
 func PrintMetrics(metrics []Metric) {
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMetricValuesValidate(t *testing.T) {
+	t.Run("should accept a valid metric", func(t *testing.T) {
+		metric := MetricValues{Host: "host1", Name: "some metric", Type: Ping}
+		assert.Empty(t, metric.Validate())
+	})
+
+	t.Run("should list every problem", func(t *testing.T) {
+		metric := MetricValues{Host: " ", Type: "cpu", State: "broken"}
+		assert.Equal(t, []string{
+			"host is required",
+			"name is required",
+			`type "cpu" is invalid`,
+			`state "broken" is invalid`,
+		}, metric.Validate())
+	})
+
+	t.Run("should require a numeric value for disk metrics", func(t *testing.T) {
+		metric := MetricValues{Host: "host1", Name: "disk", Type: Disk, Value: "full"}
+		assert.Equal(t, []string{`value "full" of a disk metric must be a number`}, metric.Validate())
+	})
+
+	t.Run("should require positive minutes as ping value", func(t *testing.T) {
+		metric := MetricValues{Host: "host1", Name: "backup", Type: Ping, Value: "-5"}
+		assert.Equal(t, []string{`value "-5" of a ping metric must be a positive number of minutes`}, metric.Validate())
+	})
+}
+
+func TestMetricBuilder(t *testing.T) {
+	t.Run("should ignore an invalid type and report it instead of exiting", func(t *testing.T) {
+		builder := NewMetricBuilder().WithHost("host1").WithType(Disk).WithType("cpu")
+		metric := builder.Build()
+		assert.Equal(t, Disk, metric.GetMetricValues().Type)
+		assert.EqualError(t, builder.Err(), "invalid metric type: cpu")
+	})
+
+	t.Run("should ignore an invalid state and report it instead of exiting", func(t *testing.T) {
+		builder := NewMetricBuilder().WithType(Ping).WithState("broken")
+		metric := builder.Build()
+		assert.Equal(t, OK, metric.GetMetricValues().State)
+		assert.EqualError(t, builder.Err(), "invalid metric state: broken")
+	})
+}
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/doug-martin/goqu/v9/exp"
+	"strings"
+)
+
+const defaultMetricsPageSize = 50
+const maxMetricsPageSize = 500
+
+type MetricQuery struct {
+	Host       string
+	NamePrefix string
+	Type       MetricType
+	State      MetricState
+	Labels     map[string]string
+	// Hosts restricts the result to these hosts if it is not empty
+	Hosts    []string
+	Page     int
+	PageSize int
+}
+
+func setDefaultMetricQuery(query *MetricQuery) *MetricQuery {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = defaultMetricsPageSize
+	}
+	if query.PageSize > maxMetricsPageSize {
+		query.PageSize = maxMetricsPageSize
+	}
+	return query
+}
+
+func (q *MetricQuery) where() (exp.ExpressionList, error) {
+	and := goqu.And()
+	if q.Host != "" {
+		and = and.Append(goqu.C("host").Eq(q.Host))
+	}
+	if len(q.Hosts) > 0 {
+		and = and.Append(goqu.C("host").In(q.Hosts))
+	}
+	if q.NamePrefix != "" {
+		and = and.Append(goqu.C("name").Like(EscapeLike(q.NamePrefix) + "%"))
+	}
+	if q.Type != "" {
+		and = and.Append(goqu.C("type").Eq(string(q.Type)))
+	}
+	if q.State != "" {
+		and = and.Append(goqu.C("state").Eq(string(q.State)))
+	}
+	if len(q.Labels) > 0 {
+		labels, err := json.Marshal(q.Labels)
+		if err != nil {
+			return nil, err
+		}
+		and = and.Append(goqu.L("labels @> ?::jsonb", string(labels)))
+	}
+	return and, nil
+}
+
+// QueryMetrics returns one page of the metrics matching the query and the number of all matching metrics.
+func (s *DbMetricsService) QueryMetrics(query *MetricQuery) ([]Metric, int, error) {
+	query = setDefaultMetricQuery(query)
+	countSql, countArgs, err := countMetricsSql(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int
+	err = s.ConnPool.QueryRow(context.Background(), countSql, countArgs...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sql, args, err := queryMetricsSql(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := s.ConnPool.Query(context.Background(), sql, args...)
+	metrics, err := rowsToMetrics(rows, err)
+	return metrics, total, err
+}
+
+func countMetricsSql(query *MetricQuery) (string, []any, error) {
+	where, err := query.where()
+	if err != nil {
+		return "", nil, err
+	}
+	return goqu.Dialect("postgres").From("metric").
+		Prepared(true).
+		Select(goqu.COUNT("*")).
+		Where(where).
+		ToSQL()
+}
+
+func queryMetricsSql(query *MetricQuery) (string, []any, error) {
+	where, err := query.where()
+	if err != nil {
+		return "", nil, err
+	}
+	return goqu.Dialect("postgres").From("metric").
+		Prepared(true).
+		Select("host", "name", "timestamp", "type", "value", "state", "labels", "id").
+		Where(where).
+		Order(goqu.C("state").Desc(), goqu.C("host").Asc(), goqu.C("name").Asc()).
+		Limit(uint(query.PageSize)).
+		Offset(uint((query.Page - 1) * query.PageSize)).
+		ToSQL()
+}
+
+// EscapeLike escapes the wildcard characters of a LIKE pattern.
+func EscapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQueryMetricsSql(t *testing.T) {
+	const selectMetrics = `SELECT "host", "name", "timestamp", "type", "value", "state", "labels", "id" FROM "metric"`
+	const order = ` ORDER BY "state" DESC, "host" ASC, "name" ASC`
+	tests := []struct {
+		name         string
+		query        MetricQuery
+		expectedSql  string
+		expectedArgs []any
+	}{
+		{
+			name:         "should return the first page of all metrics without filters",
+			query:        MetricQuery{},
+			expectedSql:  selectMetrics + order + ` LIMIT $1`,
+			expectedArgs: []any{int64(defaultMetricsPageSize)},
+		},
+		{
+			name:         "should filter by host",
+			query:        MetricQuery{Host: "server-1"},
+			expectedSql:  selectMetrics + ` WHERE ("host" = $1)` + order + ` LIMIT $2`,
+			expectedArgs: []any{"server-1", int64(defaultMetricsPageSize)},
+		},
+		{
+			name:         "should restrict to the hosts of the api key",
+			query:        MetricQuery{Hosts: []string{"server-1", "server-2"}},
+			expectedSql:  selectMetrics + ` WHERE ("host" IN ($1, $2))` + order + ` LIMIT $3`,
+			expectedArgs: []any{"server-1", "server-2", int64(defaultMetricsPageSize)},
+		},
+		{
+			name:         "should filter by an escaped name prefix",
+			query:        MetricQuery{NamePrefix: `disk_100%`},
+			expectedSql:  selectMetrics + ` WHERE ("name" LIKE $1)` + order + ` LIMIT $2`,
+			expectedArgs: []any{`disk\_100\%%`, int64(defaultMetricsPageSize)},
+		},
+		{
+			name:         "should filter by type and state",
+			query:        MetricQuery{Type: Disk, State: Alert},
+			expectedSql:  selectMetrics + ` WHERE (("type" = $1) AND ("state" = $2))` + order + ` LIMIT $3`,
+			expectedArgs: []any{"disk", "alert", int64(defaultMetricsPageSize)},
+		},
+		{
+			name:         "should filter by the labels as JSON",
+			query:        MetricQuery{Labels: map[string]string{"env": "prod", "job": "node"}},
+			expectedSql:  selectMetrics + ` WHERE labels @> $1::jsonb` + order + ` LIMIT $2`,
+			expectedArgs: []any{`{"env":"prod","job":"node"}`, int64(defaultMetricsPageSize)},
+		},
+		{
+			name:         "should skip the previous pages",
+			query:        MetricQuery{Page: 3, PageSize: 10},
+			expectedSql:  selectMetrics + order + ` LIMIT $1 OFFSET $2`,
+			expectedArgs: []any{int64(10), int64(20)},
+		},
+		{
+			name:         "should limit the page size",
+			query:        MetricQuery{PageSize: 10000},
+			expectedSql:  selectMetrics + order + ` LIMIT $1`,
+			expectedArgs: []any{int64(maxMetricsPageSize)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// act
+			sql, args, err := queryMetricsSql(setDefaultMetricQuery(&test.query))
+
+			// assert
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedSql, sql)
+			assert.Equal(t, test.expectedArgs, args)
+		})
+	}
+
+	t.Run("should count the metrics with the same filters", func(t *testing.T) {
+		// act
+		sql, args, err := countMetricsSql(setDefaultMetricQuery(&MetricQuery{Host: "server-1", State: OK, Page: 2}))
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, `SELECT COUNT(*) FROM "metric" WHERE (("host" = $1) AND ("state" = $2))`, sql)
+		assert.Equal(t, []any{"server-1", "ok"}, args)
+	})
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"plain":      "plain",
+		"100%":       `100\%`,
+		"disk_usage": `disk\_usage`,
+		`C:\data`:    `C:\\data`,
+		`\%_`:        `\\\%\_`,
+		"":           "",
+	}
+	for value, expected := range tests {
+		t.Run(value, func(t *testing.T) {
+			assert.Equal(t, expected, EscapeLike(value))
+		})
+	}
+}
@@ -2,10 +2,16 @@ package metrics
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gorlug/metrics-backend/stats"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
 	"log"
+	"strings"
+	"time"
 )
 
 type MetricsService interface {
@@ -14,8 +20,23 @@ type MetricsService interface {
 	GetAllMetrics() ([]Metric, error)
 }
 
+// ErrOutOfOrderSample is returned if a metric is older than the stored one, e.g. if a sender
+// retries a delayed request. The stored metric is kept.
+var ErrOutOfOrderSample = errors.New("sample is older than the stored sample")
+
+// ErrFutureSample is returned if the timestamp of a metric is further in the future than the
+// allowed clock skew.
+var ErrFutureSample = errors.New("sample timestamp is too far in the future")
+
+var outOfOrderSamplesTotal = stats.NewCounter("metrics_backend_out_of_order_samples_total", "Number of samples that were older than the stored sample.")
+var futureSamplesTotal = stats.NewCounter("metrics_backend_future_samples_total", "Number of samples that were too far in the future.")
+
+const DefaultMaxFutureSkew = 5 * time.Minute
+
 type DbMetricsService struct {
 	ConnPool *pgxpool.Pool
+	// MaxFutureSkew is how far the timestamp of a metric may be ahead of the server clock
+	MaxFutureSkew time.Duration
 }
 
 func NewDBMetricsService(dbUrl string, alerter Alerter) (*DbMetricsService, error) {
@@ -41,20 +62,39 @@ func NewDBMetricsService(dbUrl string, alerter Alerter) (*DbMetricsService, erro
 
 	fmt.Println("Connected to the database!!")
 
-	return &DbMetricsService{ConnPool: connPool}, nil
+	return &DbMetricsService{ConnPool: connPool, MaxFutureSkew: DefaultMaxFutureSkew}, nil
 }
 
+// SaveMetric inserts or updates the metric. A stale metric is ok again. Returns ErrOutOfOrderSample if the stored metric is
+// newer and ErrFutureSample if the metric is too far in the future.
 func (s *DbMetricsService) SaveMetric(metric MetricValues) error {
+	if metric.Timestamp.After(time.Now().Add(s.MaxFutureSkew)) {
+		futureSamplesTotal.Inc()
+		return ErrFutureSample
+	}
 	insertDynStmt := `
-insert into "metric" ("host", "name", "timestamp", "type", "value", "state")
-values ($1, $2, $3, $4, $5, $6)
+insert into "metric" ("host", "name", "timestamp", "type", "value", "state", "labels")
+values ($1, $2, $3, $4, $5, $6, $7)
 on conflict ("host", "name") do update
     set timestamp = $3,
         type      = $4,
-        value     = $5
+        value     = $5,
+        labels    = $7,
+        state     = case when metric.state = 'stale' then $6 else metric.state end
+    where metric.timestamp <= excluded.timestamp
+returning id
 `
-	_, e := s.ConnPool.Exec(context.Background(), insertDynStmt, metric.Host, metric.Name, metric.Timestamp, metric.Type, metric.Value, OK)
-	return e
+	labels := metric.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	var id int
+	err := s.ConnPool.QueryRow(context.Background(), insertDynStmt, metric.Host, metric.Name, metric.Timestamp, metric.Type, metric.Value, OK, labels).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		outOfOrderSamplesTotal.Inc()
+		return ErrOutOfOrderSample
+	}
+	return err
 }
 
 func (s *DbMetricsService) SaveState(metric MetricValues, state MetricState) error {
@@ -66,9 +106,13 @@ update "metric" set state = $1 where host = $2 and name = $3;
 }
 
 func (s *DbMetricsService) GetAllMetrics() ([]Metric, error) {
-	rows, err := s.ConnPool.Query(context.Background(), `select host, name, timestamp, type, value, state, id from metric
+	rows, err := s.ConnPool.Query(context.Background(), `select host, name, timestamp, type, value, state, labels, id from metric
 order by state desc, host, name 
 `)
+	return rowsToMetrics(rows, err)
+}
+
+func rowsToMetrics(rows pgx.Rows, err error) ([]Metric, error) {
 	if err != nil {
 		return nil, err
 	}
@@ -76,15 +120,35 @@ order by state desc, host, name
 
 	var metrics []Metric
 	for rows.Next() {
-		var metricValues MetricValues
-		err := rows.Scan(&metricValues.Host, &metricValues.Name, &metricValues.Timestamp, &metricValues.Type, &metricValues.Value, &metricValues.State, &metricValues.Id)
+		metricValues, err := scanMetricValues(rows)
 		if err != nil {
 			return nil, err
 		}
 		metrics = append(metrics, NewMetricBuilder().WithMetricValues(metricValues).Build())
 	}
 
-	return metrics, nil
+	return metrics, rows.Err()
+}
+
+func scanMetricValues(row pgx.Row) (MetricValues, error) {
+	var metricValues MetricValues
+	err := row.Scan(&metricValues.Host, &metricValues.Name, &metricValues.Timestamp, &metricValues.Type, &metricValues.Value, &metricValues.State, &metricValues.Labels, &metricValues.Id)
+	return metricValues, err
+}
+
+// GetMetric returns nil if no metric exists for the host and name.
+func (s *DbMetricsService) GetMetric(host string, name string) (Metric, error) {
+	row := s.ConnPool.QueryRow(context.Background(), `select host, name, timestamp, type, value, state, labels, id from metric
+where host = $1 and name = $2
+`, host, name)
+	metricValues, err := scanMetricValues(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewMetricBuilder().WithMetricValues(metricValues).Build(), nil
 }
 
 func (s *DbMetricsService) Close() {
@@ -96,3 +160,66 @@ func (s *DbMetricsService) DeleteMetric(id int) error {
 	_, e := s.ConnPool.Exec(context.Background(), deleteDynStmt, id)
 	return e
 }
+
+// ErrMetricReported is returned if the metric was reported again since it was read, e.g. while
+// the retirement was running. The metric is left unchanged.
+var ErrMetricReported = errors.New("metric was reported since it was read")
+
+// RetireMetric moves the metric into the metric_archive table or deletes it.
+func (s *DbMetricsService) RetireMetric(metric MetricValues, action RetirementAction) error {
+	deleteStmt := `delete from "metric" where host = $1 and name = $2 and timestamp = $3`
+	if action == Archive {
+		deleteStmt = `
+with retired as (
+    delete from "metric" where host = $1 and name = $2 and timestamp = $3
+    returning host, name, value, type, timestamp, labels
+)
+insert into "metric_archive" ("host", "name", "value", "type", "timestamp", "labels")
+select host, name, value, type, timestamp, labels from retired
+`
+	}
+	result, err := s.ConnPool.Exec(context.Background(), deleteStmt, metric.Host, metric.Name, metric.Timestamp)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrMetricReported
+	}
+	return nil
+}
+
+// MarkStale sets the state of the metric to Stale.
+func (s *DbMetricsService) MarkStale(metric MetricValues) error {
+	result, err := s.ConnPool.Exec(context.Background(), `update "metric" set state = $1 where host = $2 and name = $3 and timestamp = $4`, Stale, metric.Host, metric.Name, metric.Timestamp)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrMetricReported
+	}
+	return nil
+}
+
+// DeleteMetrics deletes all metrics of the host and/or with a name matching the pattern, in
+// which * is a wildcard. At least one of them is required.
+func (s *DbMetricsService) DeleteMetrics(host string, namePattern string) (int64, error) {
+	and := goqu.And()
+	if host != "" {
+		and = and.Append(goqu.C("host").Eq(host))
+	}
+	if namePattern != "" {
+		and = and.Append(goqu.C("name").Like(strings.ReplaceAll(EscapeLike(namePattern), "*", "%")))
+	}
+	if len(and.Expressions()) == 0 {
+		return 0, errors.New("host or pattern is required")
+	}
+	sql, args, err := goqu.Dialect("postgres").Delete("metric").Prepared(true).Where(and).ToSQL()
+	if err != nil {
+		return 0, err
+	}
+	result, err := s.ConnPool.Exec(context.Background(), sql, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorlug/metrics-backend/stats"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var metricsMarkedStaleTotal = stats.NewCounter("metrics_backend_metrics_marked_stale_total", "Number of metrics that were marked as stale.")
+var metricsRetiredTotal = stats.NewCounter("metrics_backend_metrics_retired_total", "Number of metrics that were archived or deleted.", "action")
+
+type RetirementAction string
+
+const (
+	Archive RetirementAction = "archive"
+	Delete  RetirementAction = "delete"
+)
+
+// RetirementRule applies to the metrics of the type that have all the labels. An empty type
+// matches all types. Metrics that were not reported for StaleAfterDays are marked as stale and
+// after RetireAfterDays they are archived or deleted. A value of 0 disables the step.
+type RetirementRule struct {
+	Type            MetricType        `json:"type"`
+	Labels          map[string]string `json:"labels"`
+	StaleAfterDays  int               `json:"staleAfterDays"`
+	RetireAfterDays int               `json:"retireAfterDays"`
+	Action          RetirementAction  `json:"action"`
+}
+
+func (r RetirementRule) matches(metric MetricValues) bool {
+	if r.Type != "" && r.Type != metric.Type {
+		return false
+	}
+	for key, value := range r.Labels {
+		if metric.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+type RetirementPolicy struct {
+	rules []RetirementRule
+}
+
+// NewRetirementPolicy validates the rules. The first matching rule of a metric is used.
+func NewRetirementPolicy(rules []RetirementRule) (*RetirementPolicy, error) {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Type != "" && !IsValidMetricType(string(rule.Type)) {
+			return nil, fmt.Errorf("rule %v: type %q is invalid", i, rule.Type)
+		}
+		if rule.StaleAfterDays < 0 || rule.RetireAfterDays < 0 {
+			return nil, fmt.Errorf("rule %v: days must not be negative", i)
+		}
+		if rule.Action == "" {
+			rule.Action = Archive
+		}
+		if rule.Action != Archive && rule.Action != Delete {
+			return nil, fmt.Errorf("rule %v: action %q is invalid", i, rule.Action)
+		}
+	}
+	return &RetirementPolicy{rules: rules}, nil
+}
+
+// LoadRetirementPolicy reads the rules from a JSON file. Returns nil if no file is configured.
+func LoadRetirementPolicy(file string) (*RetirementPolicy, error) {
+	if file == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []RetirementRule
+	err = json.Unmarshal(content, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %w", file, err)
+	}
+	return NewRetirementPolicy(rules)
+}
+
+func (p *RetirementPolicy) ruleFor(metric MetricValues) (RetirementRule, bool) {
+	for _, rule := range p.rules {
+		if rule.matches(metric) {
+			return rule, true
+		}
+	}
+	return RetirementRule{}, false
+}
+
+type RetirementService interface {
+	GetAllMetrics() ([]Metric, error)
+	// MarkStale and RetireMetric return ErrMetricReported if the metric was reported again since
+	// GetAllMetrics.
+	MarkStale(metric MetricValues) error
+	RetireMetric(metric MetricValues, action RetirementAction) error
+}
+
+// Notifier sends a plain message, e.g. the list of retired metrics.
+type Notifier interface {
+	Notify(message string) error
+}
+
+type MetricRetirer struct {
+	metricsService RetirementService
+	policy         *RetirementPolicy
+	notifier       Notifier
+}
+
+func NewMetricRetirer(metricsService RetirementService, policy *RetirementPolicy, notifier Notifier) *MetricRetirer {
+	return &MetricRetirer{metricsService: metricsService, policy: policy, notifier: notifier}
+}
+
+func (r *MetricRetirer) RetireMetrics() {
+	r.retire(time.Now())
+}
+
+func (r *MetricRetirer) retire(now time.Time) {
+	log.Println("Retiring stale metrics")
+	metrics, err := r.metricsService.GetAllMetrics()
+	if err != nil {
+		log.Println("failed to get metrics", err)
+		return
+	}
+	var markedStale, retired []string
+	for _, metric := range metrics {
+		metricValues := metric.GetMetricValues()
+		rule, found := r.policy.ruleFor(metricValues)
+		if !found {
+			continue
+		}
+		age := now.Sub(metricValues.Timestamp)
+		switch {
+		case rule.RetireAfterDays > 0 && age >= days(rule.RetireAfterDays):
+			err = r.metricsService.RetireMetric(metricValues, rule.Action)
+			if errors.Is(err, ErrMetricReported) {
+				continue
+			}
+			if err != nil {
+				log.Printf("failed to retire metric %v: %v", metricValues.String(), err)
+				continue
+			}
+			metricsRetiredTotal.Inc(string(rule.Action))
+			retired = append(retired, fmt.Sprintf("%v - %v (%v)", metricValues.Host, metricValues.Name, rule.Action))
+		case rule.StaleAfterDays > 0 && age >= days(rule.StaleAfterDays) && metricValues.State != Stale:
+			err = r.metricsService.MarkStale(metricValues)
+			if errors.Is(err, ErrMetricReported) {
+				continue
+			}
+			if err != nil {
+				log.Printf("failed to mark metric %v as stale: %v", metricValues.String(), err)
+				continue
+			}
+			metricsMarkedStaleTotal.Inc()
+			markedStale = append(markedStale, fmt.Sprintf("%v - %v", metricValues.Host, metricValues.Name))
+		}
+	}
+	r.notify(markedStale, retired)
+}
+
+func (r *MetricRetirer) notify(markedStale []string, retired []string) {
+	if len(markedStale) == 0 && len(retired) == 0 {
+		return
+	}
+	message := retirementMessage(markedStale, retired)
+	log.Print(message)
+	err := r.notifier.Notify(message)
+	if err != nil {
+		log.Println("failed to send retirement notification", err)
+	}
+}
+
+func retirementMessage(markedStale []string, retired []string) string {
+	var builder strings.Builder
+	sort.Strings(markedStale)
+	sort.Strings(retired)
+	if len(markedStale) > 0 {
+		builder.WriteString("Marked as stale:\n")
+		builder.WriteString(strings.Join(markedStale, "\n"))
+	}
+	if len(retired) > 0 {
+		if builder.Len() > 0 {
+			builder.WriteString("\n\n")
+		}
+		builder.WriteString("Retired:\n")
+		builder.WriteString(strings.Join(retired, "\n"))
+	}
+	return builder.String()
+}
+
+func days(count int) time.Duration {
+	return time.Duration(count) * 24 * time.Hour
+}
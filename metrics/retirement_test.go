@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type MockRetirementService struct {
+	MockMetricsService
+	retired map[string]RetirementAction
+	// reported are the names of the metrics that were reported again after GetAllMetrics
+	reported map[string]bool
+}
+
+func (m *MockRetirementService) RetireMetric(metric MetricValues, action RetirementAction) error {
+	if m.reported[metric.Name] {
+		return ErrMetricReported
+	}
+	m.retired[metric.Name] = action
+	return nil
+}
+
+func (m *MockRetirementService) MarkStale(metric MetricValues) error {
+	if m.reported[metric.Name] {
+		return ErrMetricReported
+	}
+	return m.SaveState(metric, Stale)
+}
+
+type MockNotifier struct {
+	messages []string
+}
+
+func (m *MockNotifier) Notify(message string) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func TestMetricRetirer(t *testing.T) {
+	now := time.Date(2024, 8, 13, 12, 0, 0, 0, time.UTC)
+	metric := func(name string, metricType MetricType, ageDays int, state MetricState, labels map[string]string) Metric {
+		return &MockMetric{MetricValues: MetricValues{
+			Host:      "host1",
+			Name:      name,
+			Type:      metricType,
+			State:     state,
+			Labels:    labels,
+			Timestamp: now.Add(-days(ageDays)),
+		}}
+	}
+
+	t.Run("should mark stale, retire and notify according to the first matching rule", func(t *testing.T) {
+		// arrange
+		policy, err := NewRetirementPolicy([]RetirementRule{
+			{Labels: map[string]string{"env": "test"}, StaleAfterDays: 1, RetireAfterDays: 2, Action: Delete},
+			{Type: Ping, StaleAfterDays: 7, RetireAfterDays: 30},
+		})
+		assert.NoError(t, err)
+		service := &MockRetirementService{
+			MockMetricsService: MockMetricsService{metrics: []Metric{
+				metric("test-ping", Ping, 3, Alert, map[string]string{"env": "test"}),
+				metric("old-ping", Ping, 31, Stale, nil),
+				metric("quiet-ping", Ping, 8, Alert, nil),
+				metric("already-stale", Ping, 8, Stale, nil),
+				metric("fresh-ping", Ping, 1, OK, nil),
+				metric("disk", Disk, 100, OK, nil),
+			}},
+			retired: map[string]RetirementAction{},
+		}
+		notifier := &MockNotifier{}
+
+		// act
+		NewMetricRetirer(service, policy, notifier).retire(now)
+
+		// assert
+		assert.Equal(t, map[string]RetirementAction{"test-ping": Delete, "old-ping": Archive}, service.retired)
+		assert.Equal(t, 1, len(service.stateSaved))
+		assert.Equal(t, "quiet-ping", service.stateSaved[0].Name)
+		assert.Equal(t, Stale, service.stateSaved[0].State)
+		assert.Equal(t, []string{"Marked as stale:\nhost1 - quiet-ping\n\nRetired:\nhost1 - old-ping (archive)\nhost1 - test-ping (delete)"}, notifier.messages)
+	})
+
+	t.Run("should not notify if nothing changed", func(t *testing.T) {
+		policy, err := NewRetirementPolicy([]RetirementRule{{StaleAfterDays: 7}})
+		assert.NoError(t, err)
+		service := &MockRetirementService{MockMetricsService: MockMetricsService{metrics: []Metric{metric("fresh", Ping, 1, OK, nil)}}}
+		notifier := &MockNotifier{}
+
+		NewMetricRetirer(service, policy, notifier).retire(now)
+
+		assert.Empty(t, notifier.messages)
+	})
+
+	t.Run("should keep the metrics that were reported again during the retirement", func(t *testing.T) {
+		// arrange
+		policy, err := NewRetirementPolicy([]RetirementRule{{StaleAfterDays: 7, RetireAfterDays: 30}})
+		assert.NoError(t, err)
+		service := &MockRetirementService{
+			MockMetricsService: MockMetricsService{metrics: []Metric{
+				metric("old-ping", Ping, 31, Alert, nil),
+				metric("quiet-ping", Ping, 8, Alert, nil),
+			}},
+			retired:  map[string]RetirementAction{},
+			reported: map[string]bool{"old-ping": true, "quiet-ping": true},
+		}
+		notifier := &MockNotifier{}
+
+		// act
+		NewMetricRetirer(service, policy, notifier).retire(now)
+
+		// assert
+		assert.Empty(t, service.retired)
+		assert.Empty(t, service.stateSaved)
+		assert.Empty(t, notifier.messages)
+	})
+
+	t.Run("should reject invalid rules", func(t *testing.T) {
+		_, err := NewRetirementPolicy([]RetirementRule{{Type: "cpu"}})
+		assert.Error(t, err)
+		_, err = NewRetirementPolicy([]RetirementRule{{Action: "hide"}})
+		assert.Error(t, err)
+		_, err = NewRetirementPolicy([]RetirementRule{{StaleAfterDays: -1}})
+		assert.Error(t, err)
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 )
 
 // https://api.telegram.org/bot${telegramToken.Parameter?.Value}/sendMessage?chat_id=${telegramChatId.Parameter?.Value}&text=${alarmDescription}
@@ -25,8 +26,12 @@ func (a *TelegramAlerter) AlertOkAgain(metric Metric) error {
 	return a.sendTelegramMessage(okMessage)
 }
 
+func (a *TelegramAlerter) Notify(message string) error {
+	return a.sendTelegramMessage(message)
+}
+
 func (a *TelegramAlerter) sendTelegramMessage(alertMessage string) error {
-	requestUrl := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage?chat_id=%s&text=%s", a.TelegramToken, a.TelegramChatId, alertMessage)
+	requestUrl := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage?chat_id=%s&text=%s", a.TelegramToken, url.QueryEscape(a.TelegramChatId), url.QueryEscape(alertMessage))
 	_, err := http.Get(requestUrl)
 	return err
 }
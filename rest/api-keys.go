@@ -0,0 +1,196 @@
+package rest
+
+import (
+	"github.com/gorlug/metrics-backend/apikey"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type route struct {
+	method string
+	path   string
+}
+
+// ingestionRoutes are used by the clients to send data. They are authenticated with an api key
+// instead of a user session.
+var ingestionRoutes = []route{
+	{http.MethodPost, "/metric"},
+	{http.MethodPost, "/journal"},
+	{http.MethodPost, "/journal/stream"},
+	{http.MethodPost, "/api/v1/write"},
+	{http.MethodPost, "/api/v2/write"},
+	{http.MethodPost, "/write"},
+	{http.MethodPost, "/v1/metrics"},
+	{http.MethodPost, "/v1/logs"},
+}
+
+// apiKeyRoutes accept an api key as an alternative to a user session.
+var apiKeyRoutes = []route{
+	{http.MethodGet, "/api/v1/metrics"},
+	{http.MethodGet, "/api/v1/metrics/:host/:name"},
+	{http.MethodGet, "/metrics"},
+	{http.MethodGet, "/api/v1/journal/export"},
+}
+
+func isIngestionRoute(c echo.Context) bool {
+	return matchesRoute(c, ingestionRoutes)
+}
+
+func acceptsApiKey(c echo.Context) bool {
+	return matchesRoute(c, apiKeyRoutes) && apiKeyToken(c) != ""
+}
+
+func matchesRoute(c echo.Context, routes []route) bool {
+	for _, r := range routes {
+		if c.Path() == r.path && c.Request().Method == r.method {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyToken reads the api key of the request. Besides bearer tokens the ways InfluxDB clients
+// authenticate are supported: the "Token" scheme, the password of basic auth and for the
+// InfluxDB v1 write endpoint the "p" query parameter.
+func apiKeyToken(c echo.Context) string {
+	authorization := c.Request().Header.Get(echo.HeaderAuthorization)
+	scheme, token, found := strings.Cut(authorization, " ")
+	if found && (strings.EqualFold(scheme, "Bearer") || strings.EqualFold(scheme, "Token")) {
+		return strings.TrimSpace(token)
+	}
+	if _, password, ok := c.Request().BasicAuth(); ok {
+		return password
+	}
+	if c.Path() == "/write" {
+		return c.QueryParam("p")
+	}
+	return ""
+}
+
+func authenticateApiKey(c echo.Context, apiKeyService *apikey.ApiKeyService, next echo.HandlerFunc) error {
+	token := apiKeyToken(c)
+	if token == "" {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+		return echo.NewHTTPError(http.StatusUnauthorized, "missing api key")
+	}
+	apiKey, err := apiKeyService.ValidateApiKey(token)
+	if err != nil {
+		log.Println("failed to validate api key", err)
+		return err
+	}
+	if apiKey == nil {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+	}
+	c.Set("apiKey", apiKey)
+	return next(c)
+}
+
+func getApiKey(c echo.Context) *apikey.ApiKey {
+	apiKey, ok := c.Get("apiKey").(*apikey.ApiKey)
+	if !ok {
+		return nil
+	}
+	return apiKey
+}
+
+// isHostAllowed checks the host against the api key of the request. Requests that were
+// authenticated with a user session are allowed to use every host.
+func isHostAllowed(c echo.Context, host string) bool {
+	apiKey := getApiKey(c)
+	if apiKey == nil {
+		return true
+	}
+	return apiKey.IsHostAllowed(host)
+}
+
+func (a *Api) ShowApiKeys(c echo.Context) error {
+	return apikey.NewApiKeyView(a.apiKeyService).Render(c, "", "")
+}
+
+func (a *Api) CreateApiKey(c echo.Context) error {
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	token, apiKey, err := a.apiKeyService.CreateApiKey(name, apikey.ParseHosts(c.FormValue("hosts")))
+	if err != nil {
+		log.Println("failed to create api key", err)
+		return err
+	}
+	log.Printf("created api key %v with id %v", apiKey.Name, apiKey.Id)
+	return apikey.NewApiKeyView(a.apiKeyService).Render(c, apiKey.Name, token)
+}
+
+func (a *Api) DeleteApiKey(c echo.Context) error {
+	err := a.deleteApiKey(c)
+	if err != nil {
+		return err
+	}
+	return a.ShowApiKeys(c)
+}
+
+func (a *Api) deleteApiKey(c echo.Context) error {
+	id := c.Param("id")
+	log.Printf("deleting api key with id %v", id)
+
+	intId, err := strconv.Atoi(id)
+	if err != nil {
+		log.Println("failed to convert id to int", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid id")
+	}
+
+	err = a.apiKeyService.DeleteApiKey(intId)
+	if err != nil {
+		log.Println("failed to delete api key", err)
+		return err
+	}
+	return nil
+}
+
+func (a *Api) GetApiKeysJson(c echo.Context) error {
+	apiKeys, err := a.apiKeyService.GetAllApiKeys()
+	if err != nil {
+		log.Println("failed to get api keys", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, apiKeys)
+}
+
+type CreateApiKeyBody struct {
+	Name  string   `json:"name"`
+	Hosts []string `json:"hosts"`
+}
+
+type CreatedApiKey struct {
+	Token  string         `json:"token"`
+	ApiKey *apikey.ApiKey `json:"apiKey"`
+}
+
+func (a *Api) CreateApiKeyJson(c echo.Context) error {
+	var body CreateApiKeyBody
+	if err := c.Bind(&body); err != nil {
+		return err
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+	token, apiKey, err := a.apiKeyService.CreateApiKey(strings.TrimSpace(body.Name), body.Hosts)
+	if err != nil {
+		log.Println("failed to create api key", err)
+		return err
+	}
+	log.Printf("created api key %v with id %v", apiKey.Name, apiKey.Id)
+	return c.JSON(http.StatusCreated, &CreatedApiKey{Token: token, ApiKey: apiKey})
+}
+
+func (a *Api) DeleteApiKeyJson(c echo.Context) error {
+	err := a.deleteApiKey(c)
+	if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
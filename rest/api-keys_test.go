@@ -0,0 +1,64 @@
+package rest
+
+import (
+	"github.com/gorlug/metrics-backend/apikey"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHostScopedApiKey(t *testing.T) {
+	api := &Api{}
+	e := echo.New()
+	// authenticates every request with a key that is bound to server-1
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("apiKey", &apikey.ApiKey{Id: 1, Name: "server-1", Hosts: []string{"server-1"}})
+			return next(c)
+		}
+	})
+	e.POST("/metric", api.createMetric)
+	e.POST("/journal", api.PostJournal)
+
+	post := func(path string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("should reject a metric of another host", func(t *testing.T) {
+		// act
+		recorder := post("/metric", `{"host": "server-2", "name": "backup", "type": "ping"}`)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "api key is not allowed to report for host server-2")
+	})
+
+	t.Run("should reject journal logs of another host", func(t *testing.T) {
+		// act
+		recorder := post("/journal", `{"logs": "{\"__REALTIME_TIMESTAMP\":\"1723796509016948\",\"_HOSTNAME\":\"server-2\",\"MESSAGE\":\"started\"}"}`)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+	})
+}
+
+func TestIsHostAllowed(t *testing.T) {
+	t.Run("should allow every host for a user session", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/metric", nil), httptest.NewRecorder())
+		assert.True(t, isHostAllowed(c, "server-2"))
+	})
+
+	t.Run("should check the host against the api key", func(t *testing.T) {
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/metric", nil), httptest.NewRecorder())
+		c.Set("apiKey", &apikey.ApiKey{Hosts: []string{"server-1"}})
+		assert.True(t, isHostAllowed(c, "server-1"))
+		assert.False(t, isHostAllowed(c, "server-2"))
+	})
+}
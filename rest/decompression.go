@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// decompressionMiddleware decodes gzip and zstd request bodies. It has to run before the body
+// limit, so that the limit applies to the decompressed size. Snappy bodies are passed through,
+// because the remote write handler decodes them itself.
+func decompressionMiddleware(route string, bodyLimit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			encoding := strings.ToLower(strings.TrimSpace(request.Header.Get(echo.HeaderContentEncoding)))
+			var decompressed io.ReadCloser
+			switch encoding {
+			case "", "identity", "snappy":
+				return next(c)
+			case "gzip", "x-gzip":
+				reader, err := gzip.NewReader(request.Body)
+				if err != nil {
+					ingestionRejectedTotal.Inc(route, "invalid_encoding")
+					return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid gzip body: %v", err))
+				}
+				decompressed = reader
+			case "zstd":
+				// the window is limited as well, otherwise a small body can allocate a lot of memory
+				decoder, err := zstd.NewReader(request.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(bodyLimit)))
+				if err != nil {
+					ingestionRejectedTotal.Inc(route, "invalid_encoding")
+					return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid zstd body: %v", err))
+				}
+				decompressed = decoder.IOReadCloser()
+			default:
+				ingestionRejectedTotal.Inc(route, "unsupported_encoding")
+				return errorResponse(c, http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content encoding %q", encoding))
+			}
+			defer decompressed.Close()
+
+			request.Body = &decompressedBodyReader{ReadCloser: decompressed, route: route, encoding: encoding}
+			request.Header.Del(echo.HeaderContentEncoding)
+			request.ContentLength = -1
+			return next(c)
+		}
+	}
+}
+
+// decompressedBodyReader turns corrupt compressed data into a 400 error instead of an internal
+// server error. zstd frames that announce more than the limit are rejected with 413.
+type decompressedBodyReader struct {
+	io.ReadCloser
+	route    string
+	encoding string
+}
+
+func (r *decompressedBodyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		ingestionRejectedTotal.Inc(r.route, "body_too_large")
+		return n, echo.ErrStatusRequestEntityTooLarge
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid %v body: %v", r.encoding, err)).SetInternal(err)
+	}
+	return n, err
+}
@@ -0,0 +1,72 @@
+package rest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecompressionMiddleware(t *testing.T) {
+	e := echo.New()
+	e.POST("/ingest", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	}, IngestionMiddleware("decompression", IngestionLimits{BodyLimit: 1024})...)
+
+	post := func(body []byte, encoding string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+		request.Header.Set(echo.HeaderContentEncoding, encoding)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder
+	}
+	gzipBody := func(content string) []byte {
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		_, err := writer.Write([]byte(content))
+		assert.NoError(t, err)
+		assert.NoError(t, writer.Close())
+		return buffer.Bytes()
+	}
+	zstdBody := func(content string) []byte {
+		encoder, err := zstd.NewWriter(nil)
+		assert.NoError(t, err)
+		return encoder.EncodeAll([]byte(content), nil)
+	}
+
+	t.Run("should decompress gzip and zstd bodies", func(t *testing.T) {
+		recorder := post(gzipBody("gzip content"), "gzip")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "gzip content", recorder.Body.String())
+
+		recorder = post(zstdBody("zstd content"), "zstd")
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "zstd content", recorder.Body.String())
+	})
+
+	t.Run("should apply the limit to the decompressed size", func(t *testing.T) {
+		bomb := strings.Repeat("a", 100*1024)
+		assert.Less(t, len(gzipBody(bomb)), 1024)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, post(gzipBody(bomb), "gzip").Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, post(zstdBody(bomb), "zstd").Code)
+	})
+
+	t.Run("should reject unknown encodings and corrupt bodies", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, post([]byte("content"), "br").Code)
+		assert.Equal(t, http.StatusBadRequest, post([]byte("not gzip"), "gzip").Code)
+		corrupt := gzipBody(strings.Repeat("content", 20))
+		corrupt[len(corrupt)-10] ^= 0xff
+		assert.Equal(t, http.StatusBadRequest, post(corrupt, "gzip").Code)
+	})
+}
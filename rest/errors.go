@@ -0,0 +1,24 @@
+package rest
+
+import (
+	"github.com/gorlug/metrics-backend/ingest"
+	"github.com/labstack/echo/v4"
+	"net/http"
+)
+
+type ErrorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+func errorResponse(c echo.Context, status int, problems ...string) error {
+	return c.JSON(status, &ErrorResponse{Errors: problems})
+}
+
+// ingestResponse answers batch ingestion requests. If metrics were rejected the client gets the
+// counts, otherwise an empty response like the InfluxDB and Prometheus endpoints.
+func ingestResponse(c echo.Context, result ingest.IngestResult) error {
+	if result.Complete() {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,55 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+func (a *Api) GetExpectedMetricsJson(c echo.Context) error {
+	expectedMetrics, err := a.metricsService.GetExpectedMetrics()
+	if err != nil {
+		log.Println("failed to get expected metrics", err)
+		return err
+	}
+	return c.JSON(http.StatusOK, expectedMetrics)
+}
+
+// CreateExpectedMetricJson registers an expected metric. Registering it again updates the type,
+// the grace period and the value.
+func (a *Api) CreateExpectedMetricJson(c echo.Context) error {
+	var expected ExpectedMetric
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&expected); err != nil {
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+	}
+	if problems := expected.Validate(); len(problems) > 0 {
+		return errorResponse(c, http.StatusBadRequest, problems...)
+	}
+
+	saved, err := a.metricsService.SaveExpectedMetric(expected)
+	if err != nil {
+		log.Println("failed to save expected metric", err)
+		return err
+	}
+	log.Printf("saved expected metric %v - %v", saved.Host, saved.Name)
+	return c.JSON(http.StatusCreated, saved)
+}
+
+func (a *Api) DeleteExpectedMetricJson(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid id %q", c.Param("id")))
+	}
+	err = a.metricsService.DeleteExpectedMetric(id)
+	if err != nil {
+		log.Println("failed to delete expected metric", err)
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/gorlug/metrics-backend/ingest"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"time"
+)
+
+// PostInfluxWrite receives metrics in the InfluxDB line protocol. It serves the write endpoints
+// of the InfluxDB v1 and v2 APIs, so that Telegraf can send its metrics.
+func (a *Api) PostInfluxWrite(c echo.Context) error {
+	precision, err := ingest.ParsePrecision(c.QueryParam("precision"))
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	points, problems, err := ingest.ParseLineProtocol(c.Request().Body, precision, time.Now())
+	if isBodyTooLarge(err) {
+		return err
+	}
+	if err != nil {
+		log.Println("failed to read line protocol body", err)
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("failed to read body: %v", err))
+	}
+	if len(problems) > 0 {
+		log.Printf("received invalid line protocol: %v", problems)
+		return errorResponse(c, http.StatusBadRequest, problems...)
+	}
+
+	series := make([]ingest.Series, 0, len(points))
+	for _, point := range points {
+		series = append(series, point.ToSeries()...)
+	}
+	writer := ingest.NewMetricWriter(a.metricsService, func(host string) bool {
+		return isHostAllowed(c, host)
+	})
+	err = writer.WriteSeries(series, a.influxMapper)
+	if err != nil {
+		log.Println("failed to save line protocol metrics", err)
+		return err
+	}
+	log.Printf("received %v line protocol points: %+v", len(points), writer.Result)
+	return ingestResponse(c, writer.Result)
+}
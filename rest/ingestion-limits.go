@@ -0,0 +1,213 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorlug/metrics-backend/stats"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/time/rate"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ingestionRejectedTotal = stats.NewCounter("metrics_backend_ingestion_rejected_total", "Number of rejected ingestion requests.", "route", "reason")
+
+const (
+	defaultIngestionBodyLimit = 10 << 20
+	defaultIngestionRate      = 10
+	defaultIngestionBurst     = 20
+	// defaultRemoteWriteBodyLimit is larger, because Prometheus sends batches of series
+	defaultRemoteWriteBodyLimit = 32 << 20
+)
+
+// IngestionLimits limits the body size and the request rate of an ingestion route. A rate of 0
+// disables the rate limit.
+type IngestionLimits struct {
+	BodyLimit int64
+	Rate      float64
+	Burst     int
+}
+
+// defaultRouteLimits are used instead of the default limits. The streaming routes don't hold the
+// body in memory, so they can accept larger bodies. The pre-authentication limit is shared by all
+// clients behind an IP, so it allows more requests.
+var defaultRouteLimits = map[string]IngestionLimits{
+	"journal_stream":       {BodyLimit: 1 << 30, Rate: defaultIngestionRate, Burst: defaultIngestionBurst},
+	"remote_write":         {BodyLimit: defaultRemoteWriteBodyLimit, Rate: defaultIngestionRate, Burst: defaultIngestionBurst},
+	preAuthenticationRoute: {BodyLimit: defaultIngestionBodyLimit, Rate: 10 * defaultIngestionRate, Burst: 10 * defaultIngestionBurst},
+}
+
+// preAuthenticationRoute is the name of the limits of PreAuthenticationRateLimit.
+const preAuthenticationRoute = "pre_auth"
+
+// LoadIngestionLimits reads INGESTION_BODY_LIMIT, INGESTION_RATE and INGESTION_BURST as the
+// defaults of all routes. They can be overwritten for a single route, for example with
+// INGESTION_JOURNAL_BODY_LIMIT.
+func LoadIngestionLimits(route string) (IngestionLimits, error) {
+	limits, exists := defaultRouteLimits[route]
+	if !exists {
+		limits = IngestionLimits{BodyLimit: defaultIngestionBodyLimit, Rate: defaultIngestionRate, Burst: defaultIngestionBurst}
+	}
+	prefixes := []string{"INGESTION_", "INGESTION_" + strings.ToUpper(route) + "_"}
+	for _, prefix := range prefixes {
+		if value, exists := os.LookupEnv(prefix + "BODY_LIMIT"); exists {
+			bodyLimit, err := ParseByteSize(value)
+			if err != nil {
+				return limits, fmt.Errorf("invalid %vBODY_LIMIT: %w", prefix, err)
+			}
+			limits.BodyLimit = bodyLimit
+		}
+		if value, exists := os.LookupEnv(prefix + "RATE"); exists {
+			requestRate, err := strconv.ParseFloat(value, 64)
+			if err != nil || requestRate < 0 {
+				return limits, fmt.Errorf("invalid %vRATE %q", prefix, value)
+			}
+			limits.Rate = requestRate
+		}
+		if value, exists := os.LookupEnv(prefix + "BURST"); exists {
+			burst, err := strconv.Atoi(value)
+			if err != nil || burst < 1 {
+				return limits, fmt.Errorf("invalid %vBURST %q", prefix, value)
+			}
+			limits.Burst = burst
+		}
+	}
+	return limits, nil
+}
+
+// ParseByteSize parses sizes like 512, 64K, 10M or 1G.
+func ParseByteSize(value string) (int64, error) {
+	multiplier := int64(1)
+	number := strings.ToUpper(strings.TrimSpace(value))
+	number = strings.TrimSuffix(number, "B")
+	switch {
+	case strings.HasSuffix(number, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(number, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(number, "G"):
+		multiplier = 1 << 30
+	}
+	number = strings.TrimRight(number, "KMG")
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return size * multiplier, nil
+}
+
+// IngestionMiddleware returns the middlewares of an ingestion route. They have to run after
+// the authentication, because the rate limit is per api key and only falls back to the client IP.
+// Compressed bodies are decompressed before the body limit is applied. Requests with an invalid
+// api key are limited by PreAuthenticationRateLimit instead.
+func IngestionMiddleware(route string, limits IngestionLimits) []echo.MiddlewareFunc {
+	middlewares := make([]echo.MiddlewareFunc, 0, 3)
+	if limits.Rate > 0 {
+		middlewares = append(middlewares, rateLimitMiddleware(route, limits))
+	}
+	return append(middlewares, decompressionMiddleware(route, limits.BodyLimit), bodyLimitMiddleware(route, limits.BodyLimit))
+}
+
+// PreAuthenticationRateLimit limits the requests to the ingestion routes per client IP before the
+// api key is validated, so that a flood of requests with invalid keys doesn't reach the database.
+// It has to run before the authentication middleware.
+func PreAuthenticationRateLimit(limits IngestionLimits) echo.MiddlewareFunc {
+	if limits.Rate <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+	rateLimit := rateLimitMiddleware(preAuthenticationRoute, limits)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		limited := rateLimit(next)
+		return func(c echo.Context) error {
+			if !isIngestionRoute(c) {
+				return next(c)
+			}
+			return limited(c)
+		}
+	}
+}
+
+func rateLimitMiddleware(route string, limits IngestionLimits) echo.MiddlewareFunc {
+	retryAfter := strconv.Itoa(int(math.Max(1, math.Ceil(1/limits.Rate))))
+	return middleware.RateLimiterWithConfig(middleware.RateLimiterConfig{
+		Store: middleware.NewRateLimiterMemoryStoreWithConfig(middleware.RateLimiterMemoryStoreConfig{
+			Rate:  rate.Limit(limits.Rate),
+			Burst: limits.Burst,
+		}),
+		IdentifierExtractor: func(c echo.Context) (string, error) {
+			if apiKey := getApiKey(c); apiKey != nil {
+				return fmt.Sprintf("key:%v", apiKey.Id), nil
+			}
+			return "ip:" + c.RealIP(), nil
+		},
+		DenyHandler: func(c echo.Context, identifier string, err error) error {
+			ingestionRejectedTotal.Inc(route, "rate_limited")
+			c.Response().Header().Set("Retry-After", retryAfter)
+			return errorResponse(c, http.StatusTooManyRequests, "too many requests, retry later")
+		},
+	})
+}
+
+func bodyLimitMiddleware(route string, bodyLimit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			if request.ContentLength > bodyLimit {
+				ingestionRejectedTotal.Inc(route, "body_too_large")
+				return echo.ErrStatusRequestEntityTooLarge
+			}
+			reader := &limitedBodyReader{body: request.Body, remaining: bodyLimit}
+			request.Body = reader
+
+			err := next(c)
+			if !reader.exceeded {
+				return err
+			}
+			ingestionRejectedTotal.Inc(route, "body_too_large")
+			if c.Response().Committed {
+				return err
+			}
+			return echo.ErrStatusRequestEntityTooLarge
+		}
+	}
+}
+
+// limitedBodyReader fails with a 413 error once more than the limit is read. Other than
+// http.MaxBytesReader it does not need the response writer and remembers that the limit was hit,
+// so the middleware can answer with 413 even if a handler turned the read error into a 400.
+type limitedBodyReader struct {
+	body      io.ReadCloser
+	remaining int64
+	exceeded  bool
+}
+
+func (r *limitedBodyReader) Read(p []byte) (int, error) {
+	if r.exceeded {
+		return 0, echo.ErrStatusRequestEntityTooLarge
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.body.Read(p)
+	if int64(n) > r.remaining {
+		r.exceeded = true
+		return int(r.remaining), echo.ErrStatusRequestEntityTooLarge
+	}
+	r.remaining -= int64(n)
+	return n, err
+}
+
+func (r *limitedBodyReader) Close() error {
+	return r.body.Close()
+}
+
+func isBodyTooLarge(err error) bool {
+	return errors.Is(err, echo.ErrStatusRequestEntityTooLarge)
+}
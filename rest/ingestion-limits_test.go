@@ -0,0 +1,121 @@
+package rest
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for value, expected := range map[string]int64{"512": 512, "64K": 64 << 10, "10M": 10 << 20, "1gb": 1 << 30} {
+		size, err := ParseByteSize(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, size, value)
+	}
+	for _, invalid := range []string{"", "M", "-1", "ten"} {
+		_, err := ParseByteSize(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestIngestionMiddleware(t *testing.T) {
+	e := echo.New()
+	handler := func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	}
+	e.POST("/ingest", handler, IngestionMiddleware("test", IngestionLimits{BodyLimit: 10, Rate: 1, Burst: 2})...)
+
+	post := func(body string, contentLength int64) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body))
+		request.ContentLength = contentLength
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	t.Run("should reject bodies that are too large", func(t *testing.T) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, post("01234567890", 11).Code)
+		// chunked bodies have no content length
+		assert.Equal(t, http.StatusRequestEntityTooLarge, post("01234567890", -1).Code)
+	})
+
+	t.Run("should rate limit the requests", func(t *testing.T) {
+		e.POST("/rate", handler, IngestionMiddleware("rate", IngestionLimits{BodyLimit: 10, Rate: 0.1, Burst: 2})...)
+		codes := make([]int, 0)
+		for i := 0; i < 3; i++ {
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/rate", strings.NewReader("ok")))
+			codes = append(codes, recorder.Code)
+			if recorder.Code == http.StatusTooManyRequests {
+				assert.Equal(t, "10", recorder.Header().Get("Retry-After"))
+			}
+		}
+		assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, codes)
+		assert.Equal(t, float64(1), ingestionRejectedTotal.Get("rate", "rate_limited"))
+	})
+
+	t.Run("should accept bodies within the limit", func(t *testing.T) {
+		e.POST("/accept", handler, IngestionMiddleware("accept", IngestionLimits{BodyLimit: 10})...)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/accept", strings.NewReader("0123456789")))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Equal(t, "0123456789", recorder.Body.String())
+	})
+}
+
+func TestPreAuthenticationRateLimit(t *testing.T) {
+	e := echo.New()
+	authenticated := 0
+	e.Use(PreAuthenticationRateLimit(IngestionLimits{Rate: 0.1, Burst: 2}))
+	// rejects every api key like the authentication middleware does for an invalid key
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authenticated++
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+		}
+	})
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+	e.POST("/metric", handler)
+	e.GET("/dashboard", handler)
+
+	request := func(method string, path string) int {
+		request := httptest.NewRequest(method, path, strings.NewReader("{}"))
+		request.Header.Set(echo.HeaderAuthorization, "Bearer mb_invalid")
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	t.Run("should rate limit a flood of requests with an invalid api key before the authentication", func(t *testing.T) {
+		// act
+		codes := make([]int, 0)
+		for i := 0; i < 5; i++ {
+			codes = append(codes, request(http.MethodPost, "/metric"))
+		}
+
+		// assert
+		assert.Equal(t, []int{
+			http.StatusUnauthorized,
+			http.StatusUnauthorized,
+			http.StatusTooManyRequests,
+			http.StatusTooManyRequests,
+			http.StatusTooManyRequests,
+		}, codes)
+		assert.Equal(t, 2, authenticated)
+		assert.Equal(t, float64(3), ingestionRejectedTotal.Get(preAuthenticationRoute, "rate_limited"))
+	})
+
+	t.Run("should not limit the other routes", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/dashboard"))
+	})
+}
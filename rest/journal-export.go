@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"fmt"
+	. "github.com/gorlug/metrics-backend/journal"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ExportJournal streams all logs matching the filters of the journal view as ndjson or csv.
+// Besides the format of the journal view start and end can be RFC 3339 times.
+func (a *Api) ExportJournal(c echo.Context) error {
+	query, err := ParseQuery(c.QueryParam("filter"))
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid query: %v", err))
+	}
+	maxPriority, err := ParseMaxPriority(c.QueryParam("priority"))
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, err.Error())
+	}
+	host := c.QueryParam("host")
+	if !isHostAllowed(c, host) {
+		return errorResponse(c, http.StatusForbidden, fmt.Sprintf("the api key is not allowed to export the logs of host %q", host))
+	}
+	format := c.QueryParam("format")
+	response := c.Response()
+	exporter, err := NewLogExporter(format, ParseExportFields(c.QueryParam("fields")), response)
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, err.Error())
+	}
+	if format == "" {
+		format = "ndjson"
+	}
+
+	timezone := c.QueryParam("timezone")
+	data := &LogPageData{
+		StartTime:     parseJournalTime(c.QueryParam("start"), 0, timezone),
+		EndTime:       parseJournalTime(c.QueryParam("end"), 10, timezone),
+		Descending:    c.QueryParam("order") == "desc",
+		ContainerName: c.QueryParam("container"),
+		Hostname:      host,
+		Query:         query,
+		MaxPriority:   maxPriority,
+	}
+	fileName := fmt.Sprintf("journal-%v.%v", data.StartTime.Format("2006-01-02T15-04"), format)
+	response.Header().Set(echo.HeaderContentType, exporter.ContentType())
+	response.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", fileName))
+
+	exported := 0
+	err = a.journalService.ExportLogs(c.Request().Context(), data, func(entry LogsEntry) error {
+		exported++
+		return exporter.Write(entry)
+	})
+	if err == nil {
+		err = exporter.Flush()
+	}
+	if err != nil {
+		log.Printf("failed to export journal logs after %v logs: %v", exported, err)
+		if !response.Committed {
+			response.Header().Del(echo.HeaderContentDisposition)
+			return err
+		}
+		// the status was already sent, the client gets an incomplete file
+		return nil
+	}
+	if !response.Committed {
+		// nothing was written for an empty ndjson export
+		response.WriteHeader(http.StatusOK)
+	}
+	log.Printf("exported %v journal logs", exported)
+	return nil
+}
+
+func parseJournalTime(value string, durationDifference int, timezone string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return parsed
+	}
+	return ParseTime(value, durationDifference, timezone)
+}
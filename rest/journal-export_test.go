@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"github.com/gorlug/metrics-backend/apikey"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExportJournal(t *testing.T) {
+	export := func(target string, apiKey *apikey.ApiKey) *httptest.ResponseRecorder {
+		e := echo.New()
+		request := httptest.NewRequest(http.MethodGet, target, nil)
+		recorder := httptest.NewRecorder()
+		c := e.NewContext(request, recorder)
+		if apiKey != nil {
+			c.Set("apiKey", apiKey)
+		}
+		err := (&Api{}).ExportJournal(c)
+		assert.NoError(t, err)
+		return recorder
+	}
+
+	t.Run("should reject an invalid query", func(t *testing.T) {
+		// act
+		recorder := export("/api/v1/journal/export?filter=PRIORITY%3C%3Dx", nil)
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("should reject an invalid priority", func(t *testing.T) {
+		// act
+		recorder := export("/api/v1/journal/export?priority=8", nil)
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+
+	t.Run("should reject an unknown format", func(t *testing.T) {
+		// act
+		recorder := export("/api/v1/journal/export?format=xml", nil)
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `format \"xml\" is invalid`)
+	})
+
+	t.Run("should only export the hosts of a bound api key", func(t *testing.T) {
+		// arrange
+		apiKey := &apikey.ApiKey{Hosts: []string{"couchdb-1"}}
+
+		// act
+		withoutHost := export("/api/v1/journal/export", apiKey)
+		otherHost := export("/api/v1/journal/export?host=couchdb-2", apiKey)
+
+		// assert
+		assert.Equal(t, http.StatusForbidden, withoutHost.Code)
+		assert.Equal(t, http.StatusForbidden, otherHost.Code)
+	})
+
+	t.Run("should parse RFC 3339 and journal view times", func(t *testing.T) {
+		// act
+		rfc3339 := parseJournalTime("2024-08-12T10:00:00+02:00", 0, "")
+		view := parseJournalTime("2024-08-12T10:00", 0, "Europe/Berlin")
+
+		// assert
+		assert.True(t, rfc3339.Equal(time.Date(2024, 8, 12, 8, 0, 0, 0, time.UTC)))
+		assert.True(t, view.Equal(rfc3339))
+	})
+}
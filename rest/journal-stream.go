@@ -0,0 +1,27 @@
+package rest
+
+import (
+	"fmt"
+	. "github.com/gorlug/metrics-backend/journal"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+)
+
+// PostJournalStream receives the raw output of journalctl -o json. The body is parsed and saved
+// in batches while it is read.
+func (a *Api) PostJournalStream(c echo.Context) error {
+	isAllowed := func(entry *LogsEntry) bool {
+		return isHostAllowed(c, fmt.Sprint(entry.Log["_HOSTNAME"]))
+	}
+	result, err := ReadJournalStream(c.Request().Body, DefaultJournalBatchSize, isAllowed, a.journalService.SaveJournalEntries)
+	if isBodyTooLarge(err) {
+		return err
+	}
+	if err != nil {
+		log.Printf("failed to save journal stream after %+v: %v", result, err)
+		return err
+	}
+	log.Printf("received journal stream: %+v", result)
+	return c.JSON(http.StatusOK, result)
+}
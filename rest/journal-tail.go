@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/gorlug/metrics-backend/journal"
+	"github.com/labstack/echo/v4"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const liveTailKeepAliveInterval = 15 * time.Second
+
+// TailJournal streams the new logs that match the filter of the journal view as server-sent
+// events. Every event is a rendered table row that htmx inserts into the table.
+func (a *Api) TailJournal(c echo.Context) error {
+	query, err := ParseQuery(c.QueryParam("filter"))
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid query: %v", err))
+	}
+	maxPriority, err := ParseMaxPriority(c.QueryParam("priority"))
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, err.Error())
+	}
+	filter := LogFilter{Container: c.QueryParam("container"), Host: c.QueryParam("host"), MaxPriority: maxPriority, Query: query}
+	var highlightPatterns []*regexp.Regexp
+	if query != nil {
+		highlightPatterns = query.MessagePatterns()
+	}
+
+	subscription := a.logBroadcaster.Subscribe(filter)
+	defer a.logBroadcaster.Unsubscribe(subscription)
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	// disables the buffering of nginx, otherwise the events arrive in chunks
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	keepAlive := time.NewTicker(liveTailKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := io.WriteString(response, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case entry := <-subscription.Entries:
+			row, err := CreateJournalRow(entry, filter.Container, highlightPatterns)
+			if err != nil {
+				log.Println("failed to create journal row", err)
+				continue
+			}
+			var html bytes.Buffer
+			if err := c.Echo().Renderer.Render(&html, "journalRow", row, c); err != nil {
+				log.Println("failed to render journal row", err)
+				continue
+			}
+			if err := writeServerSentEvent(response, "log", html.String()); err != nil {
+				return nil
+			}
+		}
+		response.Flush()
+	}
+}
+
+// writeServerSentEvent writes every line of the data in its own data field, a line break would
+// end the event otherwise.
+func writeServerSentEvent(w io.Writer, event string, data string) error {
+	var message strings.Builder
+	fmt.Fprintf(&message, "event: %v\n", event)
+	for _, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		fmt.Fprintf(&message, "data: %v\n", line)
+	}
+	message.WriteString("\n")
+	_, err := io.WriteString(w, message.String())
+	return err
+}
@@ -0,0 +1,68 @@
+package rest
+
+import (
+	"bufio"
+	. "github.com/gorlug/metrics-backend/journal"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTailJournal(t *testing.T) {
+	t.Run("should stream the matching logs as server-sent events", func(t *testing.T) {
+		// arrange
+		e := echo.New()
+		e.Renderer = &Templates{templates: template.Must(template.New("journalRow").Parse(
+			"<tr>\n{{ range .Cells }}<td>{{ range . }}{{ if .Match }}<mark>{{ .Text }}</mark>{{ else }}{{ .Text }}{{ end }}{{ end }}</td>{{ end }}\n</tr>"))}
+		api := &Api{logBroadcaster: NewLogBroadcaster()}
+		e.GET("/journal/tail", api.TailJournal)
+		server := httptest.NewServer(e)
+		defer server.Close()
+
+		// act
+		response, err := http.Get(server.URL + "/journal/tail?container=nginx&filter=health")
+		assert.NoError(t, err)
+		defer response.Body.Close()
+		api.logBroadcaster.LogsInserted([]*LogsEntry{
+			{Time: time.UnixMilli(0), Log: map[string]any{"CONTAINER_NAME": "nginx", "MESSAGE": "GET /favicon.ico", "_HOSTNAME": "web-1"}},
+			{Time: time.UnixMilli(0), Log: map[string]any{"CONTAINER_NAME": "nginx", "MESSAGE": "GET /health <ok>", "_HOSTNAME": "web-1"}},
+		})
+		reader := bufio.NewReader(response.Body)
+		lines := make([]string, 0)
+		for {
+			line, err := reader.ReadString('\n')
+			assert.NoError(t, err)
+			if line == "\n" {
+				break
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+
+		// assert
+		assert.Equal(t, "text/event-stream", response.Header.Get(echo.HeaderContentType))
+		assert.Equal(t, "event: log", lines[0])
+		assert.Equal(t, "data: <tr>", lines[1])
+		assert.Contains(t, lines[2], "<td>GET /<mark>health</mark> &lt;ok&gt;</td><td>web-1</td>")
+		assert.Equal(t, "data: </tr>", lines[3])
+	})
+
+	t.Run("should reject an invalid query", func(t *testing.T) {
+		// arrange
+		e := echo.New()
+		api := &Api{logBroadcaster: NewLogBroadcaster()}
+		request := httptest.NewRequest(http.MethodGet, "/journal/tail?filter=PRIORITY%3C%3Dx", nil)
+		recorder := httptest.NewRecorder()
+
+		// act
+		err := api.TailJournal(e.NewContext(request, recorder))
+
+		// assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	})
+}
@@ -0,0 +1,119 @@
+package rest
+
+import (
+	"fmt"
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type MetricsPage struct {
+	Metrics  []MetricValues `json:"metrics"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+	Total    int            `json:"total"`
+}
+
+func (a *Api) GetMetricsJson(c echo.Context) error {
+	query, problems := parseMetricQuery(c)
+	if len(problems) > 0 {
+		return errorResponse(c, http.StatusBadRequest, problems...)
+	}
+
+	metrics, total, err := a.metricsService.QueryMetrics(query)
+	if err != nil {
+		log.Println("failed to query metrics", err)
+		return err
+	}
+
+	page := &MetricsPage{
+		Metrics:  make([]MetricValues, 0, len(metrics)),
+		Page:     query.Page,
+		PageSize: query.PageSize,
+		Total:    total,
+	}
+	for _, metric := range metrics {
+		page.Metrics = append(page.Metrics, metric.GetMetricValues())
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+func parseMetricQuery(c echo.Context) (*MetricQuery, []string) {
+	problems := make([]string, 0)
+	query := &MetricQuery{
+		Host:       c.QueryParam("host"),
+		NamePrefix: c.QueryParam("namePrefix"),
+		Type:       MetricType(c.QueryParam("type")),
+		State:      MetricState(c.QueryParam("state")),
+		Labels:     map[string]string{},
+		Page:       parseIntWithDefault(c.QueryParam("page"), 1),
+		PageSize:   parseIntWithDefault(c.QueryParam("pageSize"), 0),
+	}
+	if query.Type != "" && !IsValidMetricType(string(query.Type)) {
+		problems = append(problems, fmt.Sprintf("type %q is invalid", query.Type))
+	}
+	if query.State != "" && !IsValidMetricState(string(query.State)) {
+		problems = append(problems, fmt.Sprintf("state %q is invalid", query.State))
+	}
+	for _, label := range c.QueryParams()["label"] {
+		key, value, found := strings.Cut(label, ":")
+		if !found || key == "" {
+			problems = append(problems, fmt.Sprintf("label %q must have the format key:value", label))
+			continue
+		}
+		query.Labels[key] = value
+	}
+	if apiKey := getApiKey(c); apiKey != nil {
+		query.Hosts = apiKey.Hosts
+	}
+	return query, problems
+}
+
+func (a *Api) GetMetricJson(c echo.Context) error {
+	host, err := url.PathUnescape(c.Param("host"))
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid host: %v", err))
+	}
+	name, err := url.PathUnescape(c.Param("name"))
+	if err != nil {
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid name: %v", err))
+	}
+
+	notFound := fmt.Sprintf("metric %v - %v not found", host, name)
+	if !isHostAllowed(c, host) {
+		return errorResponse(c, http.StatusNotFound, notFound)
+	}
+	metric, err := a.metricsService.GetMetric(host, name)
+	if err != nil {
+		log.Println("failed to get metric", err)
+		return err
+	}
+	if metric == nil {
+		return errorResponse(c, http.StatusNotFound, notFound)
+	}
+	return c.JSON(http.StatusOK, metric.GetMetricValues())
+}
+
+type DeleteMetricsResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// DeleteMetricsJson deletes all metrics of the host and/or with a name matching the pattern.
+func (a *Api) DeleteMetricsJson(c echo.Context) error {
+	host := c.QueryParam("host")
+	pattern := c.QueryParam("pattern")
+	if host == "" && pattern == "" {
+		return errorResponse(c, http.StatusBadRequest, "host or pattern is required")
+	}
+
+	deleted, err := a.metricsService.DeleteMetrics(host, pattern)
+	if err != nil {
+		log.Println("failed to delete metrics", err)
+		return err
+	}
+	log.Printf("deleted %v metrics of host %q with pattern %q", deleted, host, pattern)
+	return c.JSON(http.StatusOK, &DeleteMetricsResponse{Deleted: deleted})
+}
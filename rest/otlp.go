@@ -0,0 +1,112 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/gorlug/metrics-backend/ingest"
+	. "github.com/gorlug/metrics-backend/journal"
+	"github.com/labstack/echo/v4"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// PostOtlpMetrics receives metrics via OTLP/HTTP in the protobuf or JSON encoding.
+func (a *Api) PostOtlpMetrics(c echo.Context) error {
+	contentType, err := ingest.ParseOtlpContentType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return errorResponse(c, http.StatusUnsupportedMediaType, err.Error())
+	}
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Println("failed to read otlp metrics body", err)
+		return err
+	}
+	request, err := ingest.DecodeOtlpMetrics(body, contentType)
+	if err != nil {
+		log.Println("failed to decode otlp metrics", err)
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid otlp metrics: %v", err))
+	}
+
+	metrics, skipped := ingest.OtlpMetricsToMetricValues(request, time.Now())
+	writer := ingest.NewMetricWriter(a.metricsService, func(host string) bool {
+		return isHostAllowed(c, host)
+	})
+	for _, metric := range metrics {
+		err = writer.Write(metric)
+		if err != nil {
+			log.Println("failed to save otlp metrics", err)
+			return err
+		}
+	}
+	log.Printf("received %v otlp metrics: %+v, skipped data points: %v", len(metrics), writer.Result, skipped)
+
+	response := &colmetricspb.ExportMetricsServiceResponse{}
+	result := writer.Result
+	if !result.Complete() {
+		response.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: int64(result.Invalid + result.Forbidden + result.OutOfOrder + result.Future),
+			ErrorMessage: fmt.Sprintf("%v invalid data points, %v data points of hosts that are not allowed, %v out of order data points, %v data points too far in the future",
+				result.Invalid, result.Forbidden, result.OutOfOrder, result.Future),
+		}
+	}
+	return otlpResponse(c, contentType, response)
+}
+
+// PostOtlpLogs receives logs via OTLP/HTTP and saves them into the journal.
+func (a *Api) PostOtlpLogs(c echo.Context) error {
+	contentType, err := ingest.ParseOtlpContentType(c.Request().Header.Get(echo.HeaderContentType))
+	if err != nil {
+		return errorResponse(c, http.StatusUnsupportedMediaType, err.Error())
+	}
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Println("failed to read otlp logs body", err)
+		return err
+	}
+	request, err := ingest.DecodeOtlpLogs(body, contentType)
+	if err != nil {
+		log.Println("failed to decode otlp logs", err)
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid otlp logs: %v", err))
+	}
+
+	entries, err := ingest.OtlpLogsToLogsEntries(request, time.Now())
+	if err != nil {
+		log.Println("failed to convert otlp logs", err)
+		return err
+	}
+	allowedEntries := make([]*LogsEntry, 0, len(entries))
+	for _, entry := range entries {
+		if isHostAllowed(c, ingest.LogsEntryHost(entry)) {
+			allowedEntries = append(allowedEntries, entry)
+		}
+	}
+	saved, err := a.journalService.SaveLogsEntries(allowedEntries)
+	if err != nil {
+		log.Println("failed to save otlp logs", err)
+		return err
+	}
+	log.Printf("received %v otlp log records: %+v", len(entries), saved)
+
+	response := &collogspb.ExportLogsServiceResponse{}
+	rejected := len(entries) - len(allowedEntries)
+	if rejected > 0 {
+		response.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+			RejectedLogRecords: int64(rejected),
+			ErrorMessage:       "api key is not allowed to report for the host of the log records",
+		}
+	}
+	return otlpResponse(c, contentType, response)
+}
+
+func otlpResponse(c echo.Context, contentType string, response proto.Message) error {
+	encoded, err := ingest.MarshalOtlp(response, contentType)
+	if err != nil {
+		log.Println("failed to encode otlp response", err)
+		return err
+	}
+	return c.Blob(http.StatusOK, contentType, encoded)
+}
@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/gorlug/metrics-backend/stats"
+	"github.com/labstack/echo/v4"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// GetPrometheusMetrics exports all stored metrics and the process internal stats in the
+// Prometheus text format. An api key that is bound to hosts only sees the metrics of its hosts.
+func (a *Api) GetPrometheusMetrics(c echo.Context) error {
+	metrics, err := a.metricsService.GetAllMetrics()
+	if err != nil {
+		log.Println("failed to get metrics", err)
+		return err
+	}
+	return writePrometheusResponse(c, metrics)
+}
+
+func writePrometheusResponse(c echo.Context, metrics []Metric) error {
+	var allowed []Metric
+	for _, metric := range metrics {
+		if isHostAllowed(c, metric.GetMetricValues().Host) {
+			allowed = append(allowed, metric)
+		}
+	}
+
+	var buffer bytes.Buffer
+	err := writeMetricGauges(&buffer, allowed, time.Now())
+	if err != nil {
+		return err
+	}
+	err = stats.WriteMetrics(&buffer)
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, stats.ContentType, buffer.Bytes())
+}
+
+func writeMetricGauges(w io.Writer, metrics []Metric, now time.Time) error {
+	var stateSamples, valueSamples, ageSamples []stats.Sample
+	for _, metric := range metrics {
+		metricValues := metric.GetMetricValues()
+		labels := prometheusLabels(metricValues)
+		stateSamples = append(stateSamples, stats.Sample{Labels: labels, Value: stateToGaugeValue(metricValues.State)})
+		if value, err := strconv.ParseFloat(metricValues.Value, 64); err == nil {
+			valueSamples = append(valueSamples, stats.Sample{Labels: labels, Value: value})
+		}
+		ageSamples = append(ageSamples, stats.Sample{Labels: labels, Value: now.Sub(metricValues.Timestamp).Seconds()})
+	}
+
+	err := stats.WriteFamily(w, "metrics_backend_metric_state", "State of the metric: 0 = ok, 1 = alert, 2 = any other state.", "gauge", stateSamples)
+	if err != nil {
+		return err
+	}
+	err = stats.WriteFamily(w, "metrics_backend_metric_value", "Value of the metric if it is numeric.", "gauge", valueSamples)
+	if err != nil {
+		return err
+	}
+	return stats.WriteFamily(w, "metrics_backend_metric_seconds_since_last_report", "Seconds since the metric was last reported.", "gauge", ageSamples)
+}
+
+func prometheusLabels(metricValues MetricValues) []stats.Label {
+	labels := []stats.Label{
+		{Name: "host", Value: metricValues.Host},
+		{Name: "name", Value: metricValues.Name},
+		{Name: "type", Value: string(metricValues.Type)},
+	}
+	keys := make([]string, 0, len(metricValues.Labels))
+	for key := range metricValues.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	names := prometheusLabelNames(keys)
+	for _, key := range keys {
+		labels = append(labels, stats.Label{Name: names[key], Value: metricValues.Labels[key]})
+	}
+	return labels
+}
+
+// prometheusLabelNames prefixes the label keys with "label_" and replaces invalid characters.
+// Keys that end up with the same name get a numbered suffix, the keys that are already valid
+// keep their name.
+func prometheusLabelNames(keys []string) map[string]string {
+	names := make(map[string]string, len(keys))
+	used := map[string]bool{}
+	for _, valid := range []bool{true, false} {
+		for _, key := range keys {
+			sanitized := stats.SanitizeName(key)
+			if (sanitized == key) != valid {
+				continue
+			}
+			name := "label_" + sanitized
+			for suffix := 2; used[name]; suffix++ {
+				name = fmt.Sprintf("label_%v_%v", sanitized, suffix)
+			}
+			used[name] = true
+			names[key] = name
+		}
+	}
+	return names
+}
+
+func stateToGaugeValue(state MetricState) float64 {
+	switch state {
+	case OK:
+		return 0
+	case Alert:
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/gorlug/metrics-backend/apikey"
+	. "github.com/gorlug/metrics-backend/metrics"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWriteMetricGauges(t *testing.T) {
+	now := time.Date(2024, 8, 12, 10, 0, 0, 0, time.UTC)
+
+	t.Run("should export the metrics with unique label names", func(t *testing.T) {
+		// arrange
+		metric := NewMetricBuilder().WithMetricValues(MetricValues{
+			Host:      "server-1",
+			Name:      "requests",
+			Type:      Gauge,
+			State:     OK,
+			Value:     "42",
+			Timestamp: now.Add(-time.Minute),
+			Labels:    map[string]string{"a.b": "dot", "a_b": "underscore", "a-b": "dash"},
+		}).Build()
+		var buffer bytes.Buffer
+
+		// act
+		err := writeMetricGauges(&buffer, []Metric{metric}, now)
+
+		// assert
+		assert.NoError(t, err)
+		labels := `{host="server-1",name="requests",type="gauge",label_a_b_2="dash",label_a_b_3="dot",label_a_b="underscore"}`
+		assert.Equal(t, `# HELP metrics_backend_metric_state State of the metric: 0 = ok, 1 = alert, 2 = any other state.
+# TYPE metrics_backend_metric_state gauge
+metrics_backend_metric_state`+labels+` 0
+# HELP metrics_backend_metric_value Value of the metric if it is numeric.
+# TYPE metrics_backend_metric_value gauge
+metrics_backend_metric_value`+labels+` 42
+# HELP metrics_backend_metric_seconds_since_last_report Seconds since the metric was last reported.
+# TYPE metrics_backend_metric_seconds_since_last_report gauge
+metrics_backend_metric_seconds_since_last_report`+labels+` 60
+`, buffer.String())
+	})
+}
+
+func TestPrometheusResponse(t *testing.T) {
+	metrics := []Metric{
+		NewMetricBuilder().WithMetricValues(MetricValues{Host: "server-1", Name: "backup", Type: Ping, State: OK, Timestamp: time.Now()}).Build(),
+		NewMetricBuilder().WithMetricValues(MetricValues{Host: "server-2", Name: "backup", Type: Ping, State: Alert, Timestamp: time.Now()}).Build(),
+	}
+	get := func(apiKey *apikey.ApiKey) *httptest.ResponseRecorder {
+		e := echo.New()
+		e.GET("/metrics", func(c echo.Context) error {
+			if apiKey != nil {
+				c.Set("apiKey", apiKey)
+			}
+			return writePrometheusResponse(c, metrics)
+		})
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return recorder
+	}
+
+	t.Run("should only export the metrics of the hosts of the api key", func(t *testing.T) {
+		// act
+		recorder := get(&apikey.ApiKey{Id: 1, Name: "server-1", Hosts: []string{"server-1"}})
+
+		// assert
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `host="server-1"`)
+		assert.NotContains(t, recorder.Body.String(), `host="server-2"`)
+	})
+
+	t.Run("should export all metrics for a user session", func(t *testing.T) {
+		// act
+		recorder := get(nil)
+
+		// assert
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), `host="server-1"`)
+		assert.Contains(t, recorder.Body.String(), `host="server-2"`)
+	})
+}
@@ -0,0 +1,36 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/gorlug/metrics-backend/ingest"
+	"github.com/labstack/echo/v4"
+	"io"
+	"log"
+	"net/http"
+)
+
+// PostRemoteWrite receives metrics via the Prometheus remote write protocol. The body limit of
+// the route applies to the compressed and to the decoded request.
+func (a *Api) PostRemoteWrite(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Println("failed to read remote write body", err)
+		return err
+	}
+	series, err := ingest.DecodeWriteRequest(body, int(a.remoteWriteSizeLimit))
+	if err != nil {
+		log.Println("failed to decode remote write request", err)
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid write request: %v", err))
+	}
+
+	writer := ingest.NewMetricWriter(a.metricsService, func(host string) bool {
+		return isHostAllowed(c, host)
+	})
+	err = writer.WriteSeries(series, a.remoteWriteMapper)
+	if err != nil {
+		log.Println("failed to save remote write metrics", err)
+		return err
+	}
+	log.Printf("received %v remote write series: %+v", len(series), writer.Result)
+	return ingestResponse(c, writer.Result)
+}
@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"bytes"
+	"github.com/golang/snappy"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPostRemoteWrite(t *testing.T) {
+	// a write request with an unknown field of 100 bytes and without series
+	padding := append([]byte{0x2a, 100}, make([]byte, 100)...)
+	body := snappy.Encode(nil, padding)
+
+	post := func(api *Api) *httptest.ResponseRecorder {
+		e := echo.New()
+		e.POST("/api/v1/write", api.PostRemoteWrite)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/v1/write", bytes.NewReader(body)))
+		return recorder
+	}
+
+	t.Run("should limit the decoded size to the body limit of the route", func(t *testing.T) {
+		// act
+		recorder := post(&Api{remoteWriteSizeLimit: 50})
+
+		// assert
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "at most 50 are allowed")
+	})
+
+	t.Run("should accept requests within the default limit", func(t *testing.T) {
+		// act
+		recorder := post(NewApi(nil, nil, nil, nil, nil, nil, nil))
+
+		// assert
+		assert.Equal(t, http.StatusNoContent, recorder.Code)
+	})
+}
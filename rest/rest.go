@@ -1,9 +1,13 @@
 package rest
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/sessions"
+	"github.com/gorlug/metrics-backend/apikey"
 	"github.com/gorlug/metrics-backend/dashboard"
+	"github.com/gorlug/metrics-backend/ingest"
 	. "github.com/gorlug/metrics-backend/journal"
 	"github.com/gorlug/metrics-backend/logger"
 	. "github.com/gorlug/metrics-backend/metrics"
@@ -19,6 +23,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -36,7 +41,7 @@ func newTemplate() *Templates {
 	}
 }
 
-func CreateRestApi(metricsService *DbMetricsService, journalService *JournalLogService, userService *user.UserService) {
+func CreateRestApi(metricsService *DbMetricsService, journalService *JournalLogService, retentionPolicy *RetentionPolicy, userService *user.UserService, apiKeyService *apikey.ApiKeyService) {
 	goth.UseProviders(
 		google.New(os.Getenv("GOOGLE_CLIENT_ID"), os.Getenv("GOOGLE_CLIENT_SECRET"), os.Getenv("GOOGLE_CALLBACK_URL")),
 	)
@@ -46,20 +51,61 @@ func CreateRestApi(metricsService *DbMetricsService, journalService *JournalLogS
 
 	e := echo.New()
 	e.Use(middleware.Logger())
-	e.Use(CreateAuthenticationMiddleware(userService))
+	e.Use(preAuthenticationRateLimit())
+	e.Use(CreateAuthenticationMiddleware(userService, apiKeyService))
 	e.Renderer = newTemplate()
 
-	api := NewApi(metricsService, journalService, store, userService)
+	remoteWriteMapper, err := ingest.LoadSeriesMapper(os.Getenv("REMOTE_WRITE_RULES_FILE"), "instance")
+	if err != nil {
+		log.Fatalf("failed to load remote write rules: %v", err)
+	}
+
+	influxMapper, err := ingest.LoadSeriesMapper(os.Getenv("INFLUX_RULES_FILE"), "host")
+	if err != nil {
+		log.Fatalf("failed to load influx rules: %v", err)
+	}
+
+	api := NewApi(metricsService, journalService, store, userService, apiKeyService, remoteWriteMapper, influxMapper)
 
-	e.POST("/metric", api.createMetric)
+	influxLimits := ingestionLimits("influx")
+	e.POST("/metric", api.createMetric, ingestionLimits("metric")...)
+	remoteWriteLimits := loadIngestionLimits("remote_write")
+	api.remoteWriteSizeLimit = remoteWriteLimits.BodyLimit
+	e.POST("/api/v1/write", api.PostRemoteWrite, IngestionMiddleware("remote_write", remoteWriteLimits)...)
+	e.POST("/api/v2/write", api.PostInfluxWrite, influxLimits...)
+	e.POST("/write", api.PostInfluxWrite, influxLimits...)
+	e.POST("/v1/metrics", api.PostOtlpMetrics, ingestionLimits("otlp_metrics")...)
 	e.GET("/dashboard", api.ShowDashboard)
 	e.POST("/delete/:id", api.DeleteMetric)
 	log.Printf("journal service: %v", journalService)
 	if journalService != nil {
+		api.logBroadcaster = NewLogBroadcaster()
+		api.retentionPolicy = retentionPolicy
+		journalService.AddLogsListener(api.logBroadcaster)
 		e.GET("/journal", api.ShowJournal)
-		e.POST("/journal", api.PostJournal)
+		e.GET("/journal/tail", api.TailJournal)
+		e.GET("/journal/storage", api.ShowJournalStorage)
+		e.GET("/api/v1/journal/export", api.ExportJournal)
+		e.POST("/journal", api.PostJournal, ingestionLimits("journal")...)
+		e.POST("/journal/stream", api.PostJournalStream, ingestionLimits("journal_stream")...)
+		e.POST("/v1/logs", api.PostOtlpLogs, ingestionLimits("otlp_logs")...)
 	}
 
+	e.GET("/metrics", api.GetPrometheusMetrics)
+	e.GET("/api/v1/metrics", api.GetMetricsJson)
+	e.DELETE("/api/v1/metrics", api.DeleteMetricsJson)
+	e.GET("/api/v1/expected-metrics", api.GetExpectedMetricsJson)
+	e.POST("/api/v1/expected-metrics", api.CreateExpectedMetricJson)
+	e.DELETE("/api/v1/expected-metrics/:id", api.DeleteExpectedMetricJson)
+	e.GET("/api/v1/metrics/:host/:name", api.GetMetricJson)
+
+	e.GET("/api-keys", api.ShowApiKeys)
+	e.POST("/api-keys", api.CreateApiKey)
+	e.POST("/api-keys/delete/:id", api.DeleteApiKey)
+	e.GET("/api/v1/api-keys", api.GetApiKeysJson)
+	e.POST("/api/v1/api-keys", api.CreateApiKeyJson)
+	e.DELETE("/api/v1/api-keys/:id", api.DeleteApiKeyJson)
+
 	e.GET("/auth/:provider", api.Authenticate)
 	e.GET("/auth/:provider/callback", api.AuthCallback)
 	e.GET("/logout", api.Logout)
@@ -67,22 +113,63 @@ func CreateRestApi(metricsService *DbMetricsService, journalService *JournalLogS
 	e.Logger.Fatal(e.Start(":8080"))
 }
 
+func ingestionLimits(route string) []echo.MiddlewareFunc {
+	return IngestionMiddleware(route, loadIngestionLimits(route))
+}
+
+func preAuthenticationRateLimit() echo.MiddlewareFunc {
+	return PreAuthenticationRateLimit(loadIngestionLimits(preAuthenticationRoute))
+}
+
+func loadIngestionLimits(route string) IngestionLimits {
+	limits, err := LoadIngestionLimits(route)
+	if err != nil {
+		log.Fatalf("failed to load ingestion limits: %v", err)
+	}
+	log.Printf("ingestion limits of %v: %+v", route, limits)
+	return limits
+}
+
 type Api struct {
-	metricsService *DbMetricsService
-	journalService *JournalLogService
-	store          sessions.Store
-	userService    *user.UserService
+	metricsService    *DbMetricsService
+	journalService    *JournalLogService
+	store             sessions.Store
+	userService       *user.UserService
+	apiKeyService     *apikey.ApiKeyService
+	remoteWriteMapper *ingest.SeriesMapper
+	influxMapper      *ingest.SeriesMapper
+	// remoteWriteSizeLimit is the body limit of the remote write route. It limits the decoded
+	// size, because the snappy compressed body is decoded by the handler.
+	remoteWriteSizeLimit int64
+	logBroadcaster       *LogBroadcaster
+	retentionPolicy      *RetentionPolicy
 }
 
-func NewApi(metricsService *DbMetricsService, journalService *JournalLogService, store sessions.Store, userService *user.UserService) *Api {
-	return &Api{metricsService: metricsService, journalService: journalService, store: store, userService: userService}
+func NewApi(metricsService *DbMetricsService, journalService *JournalLogService, store sessions.Store, userService *user.UserService, apiKeyService *apikey.ApiKeyService, remoteWriteMapper *ingest.SeriesMapper, influxMapper *ingest.SeriesMapper) *Api {
+	return &Api{metricsService: metricsService, journalService: journalService, store: store, userService: userService, apiKeyService: apiKeyService, remoteWriteMapper: remoteWriteMapper, influxMapper: influxMapper, remoteWriteSizeLimit: defaultRemoteWriteBodyLimit}
 }
 
 func (a *Api) createMetric(c echo.Context) error {
 	var metric MetricValues
 
-	if err := c.Bind(&metric); err != nil {
-		return err
+	decoder := json.NewDecoder(c.Request().Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&metric); err != nil {
+		if isBodyTooLarge(err) {
+			return err
+		}
+		log.Println("failed to parse metric body", err)
+		return errorResponse(c, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+	}
+	metric.Id = 0
+
+	if problems := metric.Validate(); len(problems) > 0 {
+		log.Printf("received invalid metric %v: %v", metric.String(), problems)
+		return errorResponse(c, http.StatusBadRequest, problems...)
+	}
+
+	if !isHostAllowed(c, metric.Host) {
+		return errorResponse(c, http.StatusForbidden, fmt.Sprintf("api key is not allowed to report for host %v", metric.Host))
 	}
 
 	if metric.Timestamp.IsZero() {
@@ -91,6 +178,13 @@ func (a *Api) createMetric(c echo.Context) error {
 
 	log.Printf("received metric %v", metric.String())
 	err := a.metricsService.SaveMetric(metric)
+	if errors.Is(err, ErrOutOfOrderSample) {
+		log.Printf("ignoring out of order metric %v", metric.String())
+		return errorResponse(c, http.StatusConflict, err.Error())
+	}
+	if errors.Is(err, ErrFutureSample) {
+		return errorResponse(c, http.StatusBadRequest, err.Error())
+	}
 	if err != nil {
 		log.Println("failed to save metric", err)
 		return err
@@ -143,26 +237,33 @@ func (a *Api) PostJournal(c echo.Context) error {
 		return err
 	}
 
-	err = a.journalService.SaveJournalLogs(journalBody.Logs)
+	logEntries := ParseJournalLogs(journalBody.Logs)
+	for _, entry := range logEntries {
+		host := fmt.Sprint(entry.Log["_HOSTNAME"])
+		if !isHostAllowed(c, host) {
+			return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("api key is not allowed to report for host %v", host))
+		}
+	}
 
+	result, err := a.journalService.SaveJournalEntries(logEntries)
 	if err != nil {
 		log.Println("failed to save journal logs", err)
 		return err
 	}
-	return nil
+	return c.JSON(http.StatusOK, result)
 }
 
-func CreateAuthenticationMiddleware(userService *user.UserService) echo.MiddlewareFunc {
+func CreateAuthenticationMiddleware(userService *user.UserService, apiKeyService *apikey.ApiKeyService) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			paths := []string{"/auth/:provider", "/auth/:provider/callback", "/logout", "/metric"}
+			paths := []string{"/auth/:provider", "/auth/:provider/callback", "/logout"}
 			for _, path := range paths {
 				if c.Path() == path {
 					return next(c)
 				}
 			}
-			if c.Path() == "/journal" && c.Request().Method == "POST" {
-				return next(c)
+			if isIngestionRoute(c) || acceptsApiKey(c) {
+				return authenticateApiKey(c, apiKeyService, next)
 			}
 			session, err := gothic.Store.Get(c.Request(), "session")
 			if err != nil {
@@ -189,6 +290,9 @@ func CreateAuthenticationMiddleware(userService *user.UserService) echo.Middlewa
 }
 
 func redirectToAuthentication(c echo.Context) error {
+	if strings.HasPrefix(c.Path(), "/api/") {
+		return errorResponse(c, http.StatusUnauthorized, "not logged in")
+	}
 	return c.Redirect(http.StatusTemporaryRedirect, "/auth/google")
 }
 
@@ -199,17 +303,24 @@ func (a *Api) ShowJournal(c echo.Context) error {
 	start := c.QueryParam("start")
 	end := c.QueryParam("end")
 	timezone := c.QueryParam("timezone")
-	page := c.QueryParam("page")
 	pageSize := c.QueryParam("pageSize")
+	maxPriority, err := ParseMaxPriority(c.QueryParam("priority"))
+	if err != nil {
+		log.Printf("ignoring journal priority: %v", err)
+	}
 
 	renderData := &JournalRenderData{
-		Start:     ParseTime(start, 0, timezone),
-		End:       ParseTime(end, 10, timezone),
-		Page:      parseIntWithDefault(page, 1),
-		PageSize:  parseIntWithDefault(pageSize, 10),
-		Container: c.QueryParam("container"),
-		Host:      c.QueryParam("host"),
-		Filter:    c.QueryParam("filter"),
+		Start:       ParseTime(start, 0, timezone),
+		End:         ParseTime(end, 10, timezone),
+		Cursor:      c.QueryParam("cursor"),
+		PageSize:    parseIntWithDefault(pageSize, 10),
+		Container:   c.QueryParam("container"),
+		Host:        c.QueryParam("host"),
+		Filter:      c.QueryParam("filter"),
+		Descending:  c.QueryParam("order") == "desc",
+		Live:        c.QueryParam("live") == "on",
+		MaxPriority: maxPriority,
+		ErrorsOnly:  c.QueryParam("errors") == "on",
 	}
 
 	return NewJournalView(a.journalService).Render(c, renderData)
@@ -258,6 +369,10 @@ func (a *Api) Logout(c echo.Context) error {
 	return c.Redirect(http.StatusTemporaryRedirect, "/")
 }
 
+func (a *Api) ShowJournalStorage(c echo.Context) error {
+	return NewJournalStorageView(a.journalService, a.retentionPolicy).Render(c)
+}
+
 func ParseTime(timeString string, durationDifference int, timezone string) time.Time {
 	if timezone == "" {
 		timezone = "Europe/Berlin"
@@ -0,0 +1,86 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// WriteFamily writes one metric family in the Prometheus text exposition format.
+func WriteFamily(w io.Writer, name string, help string, metricType string, samples []Sample) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, metricType)
+	if err != nil {
+		return err
+	}
+	for _, sample := range samples {
+		_, err = fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(sample.Labels), formatValue(sample.Value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	formatted := make([]string, 0, len(labels))
+	for _, label := range labels {
+		formatted = append(formatted, fmt.Sprintf(`%s="%s"`, label.Name, escapeLabelValue(label.Value)))
+	}
+	return "{" + strings.Join(formatted, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsNaN(value):
+		return "NaN"
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+// SanitizeName turns an arbitrary string into a valid Prometheus metric or label name.
+func SanitizeName(name string) string {
+	var builder strings.Builder
+	for i, r := range name {
+		isLetter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r == '_'
+		isDigit := r >= '0' && r <= '9'
+		if isLetter || isDigit && i > 0 {
+			builder.WriteRune(r)
+		} else {
+			builder.WriteRune('_')
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,47 @@
+package stats
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestWriteFamily(t *testing.T) {
+	t.Run("should write help, type and escaped labels", func(t *testing.T) {
+		var buffer bytes.Buffer
+		err := WriteFamily(&buffer, "some_gauge", "Some\nhelp", "gauge", []Sample{
+			{Labels: []Label{{Name: "host", Value: `a"b\c`}, {Name: "name", Value: "line\nbreak"}}, Value: 1.5},
+			{Value: math.Inf(1)},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, `# HELP some_gauge Some\nhelp
+# TYPE some_gauge gauge
+some_gauge{host="a\"b\\c",name="line\nbreak"} 1.5
+some_gauge +Inf
+`, buffer.String())
+	})
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "service_name", SanitizeName("service.name"))
+	assert.Equal(t, "_xx", SanitizeName("1xx"))
+	assert.Equal(t, "ok_9", SanitizeName("ok_9"))
+}
+
+func TestCounter(t *testing.T) {
+	t.Run("should sum up values per label", func(t *testing.T) {
+		counter := &Counter{newFamily("test_total", "Test counter.", "counter", []string{"kind"})}
+		counter.Inc("a")
+		counter.Add(2, "a")
+		counter.Inc("b")
+
+		var buffer bytes.Buffer
+		assert.NoError(t, counter.write(&buffer))
+		assert.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{kind="a"} 3
+test_total{kind="b"} 1
+`, buffer.String())
+	})
+}
@@ -0,0 +1,141 @@
+package stats
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// collector is a process internal metric that can be written in the Prometheus text format
+type collector interface {
+	write(w io.Writer) error
+}
+
+var registry = struct {
+	mutex      sync.Mutex
+	collectors []collector
+}{}
+
+func register(c collector) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.collectors = append(registry.collectors, c)
+}
+
+// WriteMetrics writes all registered counters and gauges in the Prometheus text format.
+func WriteMetrics(w io.Writer) error {
+	registry.mutex.Lock()
+	collectors := append([]collector{}, registry.collectors...)
+	registry.mutex.Unlock()
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type family struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	mutex      sync.Mutex
+	values     map[string]*Sample
+}
+
+func newFamily(name string, help string, metricType string, labelNames []string) *family {
+	return &family{name: name, help: help, metricType: metricType, labelNames: labelNames, values: map[string]*Sample{}}
+}
+
+func (f *family) update(labelValues []string, update func(value float64) float64) {
+	if len(labelValues) != len(f.labelNames) {
+		panic("stats: wrong number of label values for " + f.name)
+	}
+	key := strings.Join(labelValues, "\xff")
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	sample, exists := f.values[key]
+	if !exists {
+		labels := make([]Label, len(labelValues))
+		for i, value := range labelValues {
+			labels[i] = Label{Name: f.labelNames[i], Value: value}
+		}
+		sample = &Sample{Labels: labels}
+		f.values[key] = sample
+	}
+	sample.Value = update(sample.Value)
+}
+
+func (f *family) get(labelValues ...string) float64 {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	sample, exists := f.values[strings.Join(labelValues, "\xff")]
+	if !exists {
+		return 0
+	}
+	return sample.Value
+}
+
+func (f *family) write(w io.Writer) error {
+	f.mutex.Lock()
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		samples = append(samples, *f.values[key])
+	}
+	f.mutex.Unlock()
+	if len(samples) == 0 && len(f.labelNames) == 0 {
+		samples = append(samples, Sample{})
+	}
+	return WriteFamily(w, f.name, f.help, f.metricType, samples)
+}
+
+type Counter struct {
+	*family
+}
+
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	counter := &Counter{newFamily(name, help, "counter", labelNames)}
+	register(counter)
+	return counter
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.update(labelValues, func(current float64) float64 {
+		return current + value
+	})
+}
+
+func (c *Counter) Get(labelValues ...string) float64 {
+	return c.get(labelValues...)
+}
+
+type Gauge struct {
+	*family
+}
+
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	gauge := &Gauge{newFamily(name, help, "gauge", labelNames)}
+	register(gauge)
+	return gauge
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 {
+		return value
+	})
+}
+
+func (g *Gauge) Get(labelValues ...string) float64 {
+	return g.get(labelValues...)
+}
@@ -0,0 +1,6 @@
+-- trigram index for the message search of the journal view, it supports ILIKE and regular expressions
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- creates the index chunk by chunk, so existing hypertables are not locked for the whole time
+CREATE INDEX IF NOT EXISTS "logs_message_trgm_idx" ON "logs" USING GIN ((log->>'MESSAGE') gin_trgm_ops)
+    WITH (timescaledb.transaction_per_chunk);
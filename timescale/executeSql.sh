@@ -3,3 +3,5 @@
 . .env
 psql -Atx $TIMESCALE_DATABASE_URL_INIT -f ./createDb.sql
 psql -Atx $TIMESCALE_DATABASE_URL -f ./createTable.sql
+psql -Atx $TIMESCALE_DATABASE_URL -f ./addMessageSearch.sql
+psql -Atx $TIMESCALE_DATABASE_URL -f ./removeRetentionPolicy.sql
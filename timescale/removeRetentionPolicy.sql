@@ -0,0 +1,2 @@
+-- the logs are deleted by the retention rules of the backend instead, see JOURNAL_RETENTION_RULES_FILE
+SELECT remove_retention_policy('logs', if_exists => TRUE);